@@ -68,4 +68,31 @@ resource "aws_db_instance" "main" {
   tags = {
     Name = "${var.environment}-database"
   }
-}
\ No newline at end of file
+}
+
+# AWS Secrets Manager secret with connection details for applications
+resource "aws_secretsmanager_secret" "db_credentials" {
+  name_prefix             = "${var.environment}-database-credentials-"
+  description             = "Connection credentials for the ${var.environment} RDS database"
+  recovery_window_in_days = var.secret_recovery_window
+
+  lifecycle {
+    create_before_destroy = true
+  }
+
+  tags = {
+    Name = "${var.environment}-database-credentials"
+  }
+}
+
+resource "aws_secretsmanager_secret_version" "db_credentials" {
+  secret_id = aws_secretsmanager_secret.db_credentials.id
+  secret_string = jsonencode({
+    engine   = "postgres"
+    host     = aws_db_instance.main.address
+    port     = aws_db_instance.main.port
+    dbname   = var.database_name
+    username = var.database_username
+    password = var.database_password
+  })
+}
@@ -26,4 +26,9 @@ output "db_instance_arn" {
 output "db_security_group_id" {
   description = "Security group ID for RDS"
   value       = aws_security_group.rds.id
-}
\ No newline at end of file
+}
+
+output "credentials_secret_arn" {
+  description = "ARN of the AWS Secrets Manager secret containing database connection credentials"
+  value       = aws_secretsmanager_secret.db_credentials.arn
+}
@@ -61,4 +61,10 @@ variable "backup_retention_period" {
 variable "aws_region" {
   description = "AWS region"
   type        = string
-}
\ No newline at end of file
+}
+
+variable "secret_recovery_window" {
+  description = "Number of days to retain secret after deletion"
+  type        = number
+  default     = 7
+}
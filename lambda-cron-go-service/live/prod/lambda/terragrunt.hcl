@@ -22,6 +22,7 @@ dependency "ecr" {
   mock_outputs = {
     repository_url = "123456789012.dkr.ecr.us-east-1.amazonaws.com/prod-lambda-cron-go-service"
     worker_repository_url = "123456789012.dkr.ecr.us-east-1.amazonaws.com/prod-lambda-cron-go-worker"
+    status_api_repository_url = "123456789012.dkr.ecr.us-east-1.amazonaws.com/prod-lambda-cron-go-status-api"
   }
   mock_outputs_allowed_terraform_commands = ["init", "plan", "validate"]
 }
@@ -39,6 +40,24 @@ dependency "timestream_influxdb" {
   mock_outputs_allowed_terraform_commands = ["init", "plan", "validate"]
 }
 
+dependency "rds" {
+  config_path = "../../../../infrastructure/live/prod/rds"
+  
+  mock_outputs = {
+    credentials_secret_arn = "arn:aws:secretsmanager:us-east-1:123456789012:secret:prod-database-credentials"
+  }
+  mock_outputs_allowed_terraform_commands = ["init", "plan", "validate"]
+}
+
+dependency "stepfunctions" {
+  config_path = "../../../../lambda-step-service/live/prod/stepfunctions"
+  
+  mock_outputs = {
+    state_machine_arn = "arn:aws:states:us-east-1:123456789012:stateMachine:prod-processing-workflow"
+  }
+  mock_outputs_allowed_terraform_commands = ["init", "plan", "validate"]
+}
+
 inputs = {
   environment = "prod"
   
@@ -53,10 +72,32 @@ inputs = {
   # ECR image URIs - these should be set after building and pushing the images
   image_uri        = "${dependency.ecr.outputs.repository_url}:latest"
   worker_image_uri = "${dependency.ecr.outputs.worker_repository_url}:latest"
+  status_api_image_uri = "${dependency.ecr.outputs.status_api_repository_url}:latest"
   
   # InfluxDB secret ARN for IAM permissions - use custom credentials secret with write access
   influxdb_secret_arn = dependency.timestream_influxdb.outputs.credentials_secret_arn
   
+  # Postgres credentials for worker data_processing actions
+  database_secret_arn = dependency.rds.outputs.credentials_secret_arn
+  
+  # Step Functions workflow started by workflow work items
+  workflow_state_machine_arn = dependency.stepfunctions.outputs.state_machine_arn
+  
+  # Throughput caps per work type, enforced by the worker
+  rate_limits = {
+    email_notification = { rate_per_second = 10 }
+  }
+  rate_limit_mode = "shared"
+  
+  # Named schedules, defined in the producer's schedules.json
+  named_schedules = {
+    "hourly-cleanup" = "cron(0 * * * ? *)"
+    "nightly-backup" = "cron(0 2 * * ? *)"
+    "monthly-report" = "cron(0 6 1 * ? *)"
+    # 09:00 Europe/Berlin falls at 07:00 or 08:00 UTC; calendar rules pick one
+    "weekday-digest" = "cron(0 7,8 ? * MON-FRI *)"
+  }
+  
   environment_variables = {
     LOG_LEVEL   = "warn"
     ENVIRONMENT = "prod"
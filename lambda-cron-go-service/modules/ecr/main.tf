@@ -36,6 +36,25 @@ resource "aws_ecr_repository" "worker_repo" {
   }
 }
 
+# Status API lambda repository
+resource "aws_ecr_repository" "status_api_repo" {
+  name                 = "${var.environment}-${replace(var.project_name, "service", "status-api")}"
+  image_tag_mutability = "MUTABLE"
+
+  image_scanning_configuration {
+    scan_on_push = true
+  }
+
+  encryption_configuration {
+    encryption_type = "AES256"
+  }
+
+  tags = {
+    Name        = "${var.environment}-${replace(var.project_name, "service", "status-api")}"
+    Environment = var.environment
+  }
+}
+
 resource "aws_ecr_lifecycle_policy" "lambda_repo_policy" {
   repository = aws_ecr_repository.lambda_repo.name
 
@@ -106,6 +125,41 @@ resource "aws_ecr_lifecycle_policy" "worker_repo_policy" {
   })
 }
 
+resource "aws_ecr_lifecycle_policy" "status_api_repo_policy" {
+  repository = aws_ecr_repository.status_api_repo.name
+
+  policy = jsonencode({
+    rules = [
+      {
+        rulePriority = 1
+        description  = "Keep last 10 images"
+        selection = {
+          tagStatus     = "tagged"
+          tagPrefixList = ["v"]
+          countType     = "imageCountMoreThan"
+          countNumber   = 10
+        }
+        action = {
+          type = "expire"
+        }
+      },
+      {
+        rulePriority = 2
+        description  = "Delete untagged images older than 1 day"
+        selection = {
+          tagStatus   = "untagged"
+          countType   = "sinceImagePushed"
+          countUnit   = "days"
+          countNumber = 1
+        }
+        action = {
+          type = "expire"
+        }
+      }
+    ]
+  })
+}
+
 data "aws_iam_policy_document" "ecr_policy" {
   statement {
     sid    = "LambdaPullAccess"
@@ -132,4 +186,9 @@ resource "aws_ecr_repository_policy" "lambda_repo_policy" {
 resource "aws_ecr_repository_policy" "worker_repo_policy" {
   repository = aws_ecr_repository.worker_repo.name
   policy     = data.aws_iam_policy_document.ecr_policy.json
-}
\ No newline at end of file
+}
+
+resource "aws_ecr_repository_policy" "status_api_repo_policy" {
+  repository = aws_ecr_repository.status_api_repo.name
+  policy     = data.aws_iam_policy_document.ecr_policy.json
+}
@@ -18,6 +18,16 @@ output "worker_repository_name" {
   value       = aws_ecr_repository.worker_repo.name
 }
 
+output "status_api_repository_url" {
+  description = "ECR repository URL for status API lambda"
+  value       = aws_ecr_repository.status_api_repo.repository_url
+}
+
+output "status_api_repository_name" {
+  description = "ECR repository name for status API lambda"
+  value       = aws_ecr_repository.status_api_repo.name
+}
+
 output "registry_id" {
   description = "ECR registry ID"
   value       = aws_ecr_repository.lambda_repo.registry_id
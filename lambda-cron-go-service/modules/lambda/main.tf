@@ -11,6 +11,55 @@
 
 data "aws_caller_identity" "current" {}
 
+locals {
+  # Deliveries before a work item is moved to the DLQ; the worker needs it
+  # to recognise the final attempt
+  max_receive_count = 3
+
+  # Metrics backends shared by the producer and the worker
+  metrics_environment = merge(
+    {
+      METRICS_SINKS         = join(",", var.metrics_sinks)
+      METRICS_NAMESPACE     = var.metrics_namespace
+      METRICS_ERROR_POLICY  = var.metrics_error_policy
+      METRICS_FALLBACK_SINK = var.metrics_fallback_sink
+      METRICS_SCHEMA_MODE   = var.metrics_schema_mode
+      METRICS_SPOOL_MAX_MB  = tostring(var.metrics_spool_max_mb)
+    },
+    var.prometheus_remote_write_url != null ? {
+      PROMETHEUS_REMOTE_WRITE_URL   = var.prometheus_remote_write_url
+      PROMETHEUS_REMOTE_WRITE_SIGV4 = tostring(var.prometheus_workspace_arn != null)
+    } : {},
+    var.enable_metrics_spool_bucket ? {
+      METRICS_SPOOL_BUCKET = aws_s3_bucket.metrics_spool[0].id
+    } : {}
+  )
+
+  # Personal data redaction shared by the producer and the worker, so the
+  # same email or user ID hashes the same in both
+  redaction_environment = merge(
+    {
+      REDACT_KEYS    = join(",", var.redact_keys)
+      REDACTION_MODE = var.redaction_mode
+    },
+    var.redaction_hash_key != null ? {
+      REDACTION_HASH_KEY = var.redaction_hash_key
+    } : {}
+  )
+
+  # Trace export shared by the producer and the worker; each names its own
+  # service, and the environment tells their traces apart
+  tracing_environment = merge(
+    {
+      OTEL_TRACES_EXPORTER     = var.tracing_exporter
+      OTEL_RESOURCE_ATTRIBUTES = "deployment.environment=${var.environment}"
+    },
+    var.otlp_endpoint != null ? {
+      OTEL_EXPORTER_OTLP_ENDPOINT = var.otlp_endpoint
+    } : {}
+  )
+}
+
 
 resource "aws_iam_role" "lambda_role" {
   name = "${var.environment}-${var.project_name}-role"
@@ -80,9 +129,19 @@ resource "aws_lambda_function" "main" {
   environment {
     variables = merge(
       {
-        ENVIRONMENT   = var.environment
-        SQS_QUEUE_URL = aws_sqs_queue.work_queue.url
+        ENVIRONMENT              = var.environment
+        SQS_QUEUE_URL            = aws_sqs_queue.work_queue.url
+        STATUS_TABLE_NAME        = aws_dynamodb_table.work_item_status.name
+        PAUSE_PARAMETER_NAME     = aws_ssm_parameter.work_pauses.name
+        PAUSE_CACHE_TTL_SECONDS  = tostring(var.pause_cache_ttl_seconds)
+        SECRET_CACHE_TTL_SECONDS = tostring(var.secret_cache_ttl_seconds)
       },
+      # The producer only sends its default workflow item when there is a
+      # state machine to run it
+      var.workflow_state_machine_arn != null ? { WORKFLOW_STATE_MACHINE_ARN = var.workflow_state_machine_arn } : {},
+      local.metrics_environment,
+      local.redaction_environment,
+      local.tracing_environment,
       var.environment_variables
     )
   }
@@ -206,6 +265,35 @@ resource "aws_lambda_permission" "allow_eventbridge" {
   source_arn    = aws_cloudwatch_event_rule.hourly_cron.arn
 }
 
+# EventBridge rules for named schedules. Each passes its schedule name so the
+# function sends that schedule's work items from schedules.json.
+resource "aws_cloudwatch_event_rule" "named_schedule" {
+  for_each = var.named_schedules
+
+  name                = "${var.environment}-${var.project_name}-${each.key}"
+  description         = "Trigger lambda function for the ${each.key} schedule"
+  schedule_expression = each.value
+}
+
+resource "aws_cloudwatch_event_target" "named_schedule" {
+  for_each = var.named_schedules
+
+  rule      = aws_cloudwatch_event_rule.named_schedule[each.key].name
+  target_id = "LambdaCronTarget"
+  arn       = aws_lambda_function.main.arn
+  input     = jsonencode({ schedule = each.key })
+}
+
+resource "aws_lambda_permission" "allow_named_schedule" {
+  for_each = var.named_schedules
+
+  statement_id  = "AllowExecutionFromEventBridge-${each.key}"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.main.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.named_schedule[each.key].arn
+}
+
 # SQS Queue for work items
 resource "aws_sqs_queue" "work_queue" {
   name                       = "${var.environment}-go-work-queue"
@@ -231,7 +319,7 @@ resource "aws_sqs_queue_redrive_policy" "work_queue_redrive" {
   queue_url = aws_sqs_queue.work_queue.id
   redrive_policy = jsonencode({
     deadLetterTargetArn = aws_sqs_queue.work_queue_dlq.arn
-    maxReceiveCount     = 3
+    maxReceiveCount     = local.max_receive_count
   })
 }
 
@@ -247,9 +335,43 @@ resource "aws_lambda_function" "worker" {
   environment {
     variables = merge(
       {
-        ENVIRONMENT   = var.environment
-        SQS_QUEUE_URL = aws_sqs_queue.work_queue.url
+        ENVIRONMENT       = var.environment
+        SQS_QUEUE_URL     = aws_sqs_queue.work_queue.url
+        STATUS_TABLE_NAME = aws_dynamodb_table.work_item_status.name
+        MAX_RECEIVE_COUNT = tostring(local.max_receive_count)
       },
+      {
+        REPORTS_BUCKET             = aws_s3_bucket.reports.id
+        COMPLETION_EVENT_TARGET    = var.completion_event_target
+        COMPLETION_EVENT_BUS_NAME  = var.completion_event_bus_name
+        COMPLETION_EVENT_TOPIC_ARN = var.completion_event_topic_arn != null ? var.completion_event_topic_arn : ""
+      },
+      {
+        CIRCUIT_BREAKER_FAILURE_THRESHOLD = tostring(var.circuit_breaker_failure_threshold)
+        CIRCUIT_BREAKER_COOLDOWN_SECONDS  = tostring(var.circuit_breaker_cooldown_seconds)
+        DRAIN_SAFETY_MARGIN_SECONDS       = tostring(var.drain_safety_margin_seconds)
+        VISIBILITY_HEARTBEAT_SECONDS      = tostring(var.visibility_heartbeat_seconds)
+        PAUSE_PARAMETER_NAME              = aws_ssm_parameter.work_pauses.name
+        PAUSE_CACHE_TTL_SECONDS           = tostring(var.pause_cache_ttl_seconds)
+        SECRET_CACHE_TTL_SECONDS          = tostring(var.secret_cache_ttl_seconds)
+        PAUSE_HOLD_SECONDS                = tostring(var.pause_hold_seconds)
+      },
+      var.enable_shared_circuit_breaker ? { CIRCUIT_BREAKER_TABLE_NAME = aws_dynamodb_table.circuit_breaker[0].name } : {},
+      length(var.rate_limits) > 0 ? {
+        RATE_LIMITS = jsonencode({
+          for work_type, limit in var.rate_limits : work_type => {
+            ratePerSecond = limit.rate_per_second
+            burst         = limit.burst
+          }
+        })
+        RATE_LIMIT_MODE = var.rate_limit_mode
+      } : {},
+      var.rate_limit_mode == "shared" ? { RATE_LIMIT_TABLE_NAME = aws_dynamodb_table.rate_limit[0].name } : {},
+      var.database_secret_arn != null ? { DATABASE_SECRET_ARN = var.database_secret_arn } : {},
+      var.workflow_state_machine_arn != null ? { WORKFLOW_STATE_MACHINE_ARN = var.workflow_state_machine_arn } : {},
+      local.metrics_environment,
+      local.redaction_environment,
+      local.tracing_environment,
       var.environment_variables
     )
   }
@@ -310,6 +432,10 @@ resource "aws_lambda_event_source_mapping" "sqs_trigger" {
   function_name    = aws_lambda_function.worker.arn
   batch_size       = var.sqs_batch_size != null ? var.sqs_batch_size : 1
 
+  # The worker reports transient failures individually so only those
+  # messages are redelivered
+  function_response_types = ["ReportBatchItemFailures"]
+
   depends_on = [aws_iam_role_policy.sqs_permissions]
 }
 
@@ -336,7 +462,8 @@ resource "aws_iam_role_policy" "sqs_permissions" {
   })
 }
 
-# SQS permissions for worker Lambda function
+# SQS permissions for worker Lambda function. SendMessage also covers
+# SendMessageBatch, used to enqueue follow-up and child work items.
 resource "aws_iam_role_policy" "worker_sqs_permissions" {
   name = "${var.environment}-${replace(var.project_name, "service", "worker")}-sqs-policy"
   role = aws_iam_role.worker_lambda_role.id
@@ -347,6 +474,7 @@ resource "aws_iam_role_policy" "worker_sqs_permissions" {
       {
         Effect = "Allow"
         Action = [
+          "sqs:SendMessage",
           "sqs:ReceiveMessage",
           "sqs:DeleteMessage",
           "sqs:GetQueueAttributes",
@@ -400,4 +528,619 @@ resource "aws_iam_role_policy" "worker_influxdb_secrets_permissions" {
       }
     ]
   })
-}
\ No newline at end of file
+}
+
+# IAM policy for database Secrets Manager access (worker Lambda)
+resource "aws_iam_role_policy" "worker_database_secrets_permissions" {
+  count = var.database_secret_arn != null ? 1 : 0
+  name  = "${var.environment}-${replace(var.project_name, "service", "worker")}-database-secrets-policy"
+  role  = aws_iam_role.worker_lambda_role.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Allow"
+        Action = [
+          "secretsmanager:GetSecretValue"
+        ]
+        Resource = [
+          var.database_secret_arn
+        ]
+      }
+    ]
+  })
+}
+
+# S3 bucket for reports generated by the worker
+resource "aws_s3_bucket" "reports" {
+  bucket = "${var.environment}-${var.project_name}-reports-${data.aws_caller_identity.current.account_id}"
+
+  tags = {
+    Name = "${var.environment}-${var.project_name}-reports"
+  }
+}
+
+resource "aws_s3_bucket_server_side_encryption_configuration" "reports" {
+  bucket = aws_s3_bucket.reports.id
+
+  rule {
+    apply_server_side_encryption_by_default {
+      sse_algorithm = "AES256"
+    }
+  }
+}
+
+resource "aws_s3_bucket_public_access_block" "reports" {
+  bucket = aws_s3_bucket.reports.id
+
+  block_public_acls       = true
+  block_public_policy     = true
+  ignore_public_acls      = true
+  restrict_public_buckets = true
+}
+
+# IAM policy for writing reports (worker Lambda)
+resource "aws_iam_role_policy" "worker_reports_permissions" {
+  name = "${var.environment}-${replace(var.project_name, "service", "worker")}-reports-policy"
+  role = aws_iam_role.worker_lambda_role.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Allow"
+        Action = [
+          "s3:PutObject"
+        ]
+        Resource = [
+          "${aws_s3_bucket.reports.arn}/reports/*"
+        ]
+      }
+    ]
+  })
+}
+
+# IAM policy for publishing completion events (worker Lambda)
+resource "aws_iam_role_policy" "worker_completion_events_permissions" {
+  count = var.completion_event_target != "none" ? 1 : 0
+  name  = "${var.environment}-${replace(var.project_name, "service", "worker")}-completion-events-policy"
+  role  = aws_iam_role.worker_lambda_role.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      var.completion_event_target == "eventbridge" ? {
+        Effect = "Allow"
+        Action = [
+          "events:PutEvents"
+        ]
+        Resource = [
+          "arn:aws:events:${var.aws_region}:${data.aws_caller_identity.current.account_id}:event-bus/${var.completion_event_bus_name}"
+        ]
+      } : {
+        Effect = "Allow"
+        Action = [
+          "sns:Publish"
+        ]
+        Resource = [
+          var.completion_event_topic_arn
+        ]
+      }
+    ]
+  })
+}
+
+# DynamoDB table tracking work item state transitions, keyed by run and work ID
+resource "aws_dynamodb_table" "work_item_status" {
+  name         = "${var.environment}-${var.project_name}-work-item-status"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "runId"
+  range_key    = "workId"
+
+  attribute {
+    name = "runId"
+    type = "S"
+  }
+
+  attribute {
+    name = "workId"
+    type = "N"
+  }
+
+  attribute {
+    name = "typeStatus"
+    type = "S"
+  }
+
+  attribute {
+    name = "updatedAt"
+    type = "S"
+  }
+
+  # Lookup of a work ID across runs
+  global_secondary_index {
+    name            = "workId-index"
+    hash_key        = "workId"
+    range_key       = "updatedAt"
+    projection_type = "ALL"
+  }
+
+  # Lookup by "<workType>#<status>"
+  global_secondary_index {
+    name            = "typeStatus-index"
+    hash_key        = "typeStatus"
+    range_key       = "updatedAt"
+    projection_type = "ALL"
+  }
+
+  ttl {
+    attribute_name = "expiresAt"
+    enabled        = true
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  point_in_time_recovery {
+    enabled = var.environment == "prod"
+  }
+
+  tags = {
+    Name = "${var.environment}-${var.project_name}-work-item-status"
+  }
+}
+
+# Status table write permissions for both Lambda functions. The worker also
+# reads items back to release or skip dependent work items.
+resource "aws_iam_role_policy" "status_table_permissions" {
+  name = "${var.environment}-${var.project_name}-status-table-policy"
+  role = aws_iam_role.lambda_role.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Allow"
+        Action = [
+          "dynamodb:UpdateItem"
+        ]
+        Resource = [
+          aws_dynamodb_table.work_item_status.arn
+        ]
+      }
+    ]
+  })
+}
+
+resource "aws_iam_role_policy" "worker_status_table_permissions" {
+  name = "${var.environment}-${replace(var.project_name, "service", "worker")}-status-table-policy"
+  role = aws_iam_role.worker_lambda_role.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Allow"
+        Action = [
+          "dynamodb:UpdateItem",
+          "dynamodb:GetItem",
+          "dynamodb:Query"
+        ]
+        Resource = [
+          aws_dynamodb_table.work_item_status.arn
+        ]
+      }
+    ]
+  })
+}
+
+# IAM role for status API Lambda function
+resource "aws_iam_role" "status_api_lambda_role" {
+  name = "${var.environment}-${replace(var.project_name, "service", "status-api")}-role"
+
+  assume_role_policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Action = "sts:AssumeRole"
+        Effect = "Allow"
+        Principal = {
+          Service = "lambda.amazonaws.com"
+        }
+      }
+    ]
+  })
+}
+
+resource "aws_iam_role_policy_attachment" "status_api_lambda_basic" {
+  policy_arn = "arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole"
+  role       = aws_iam_role.status_api_lambda_role.name
+}
+
+resource "aws_iam_role_policy" "status_api_table_permissions" {
+  name = "${var.environment}-${replace(var.project_name, "service", "status-api")}-status-table-policy"
+  role = aws_iam_role.status_api_lambda_role.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Allow"
+        Action = [
+          "dynamodb:GetItem",
+          "dynamodb:Query"
+        ]
+        Resource = [
+          aws_dynamodb_table.work_item_status.arn,
+          "${aws_dynamodb_table.work_item_status.arn}/index/*"
+        ]
+      }
+    ]
+  })
+}
+
+# Status API Lambda Function (read-only, so it does not need VPC access)
+resource "aws_lambda_function" "status_api" {
+  package_type  = "Image"
+  image_uri     = var.status_api_image_uri != null ? var.status_api_image_uri : var.image_uri
+  function_name = "${var.environment}-${replace(var.project_name, "service", "status-api")}-function"
+  role          = aws_iam_role.status_api_lambda_role.arn
+  timeout       = 10
+  memory_size   = 128
+
+  environment {
+    variables = {
+      ENVIRONMENT       = var.environment
+      STATUS_TABLE_NAME = aws_dynamodb_table.work_item_status.name
+    }
+  }
+
+  depends_on = [
+    aws_iam_role_policy_attachment.status_api_lambda_basic,
+  ]
+}
+
+# Function URL for the status API, callers sign requests with IAM credentials
+resource "aws_lambda_function_url" "status_api" {
+  function_name      = aws_lambda_function.status_api.function_name
+  authorization_type = "AWS_IAM"
+}
+
+# IAM policy for starting and following workflow executions (worker Lambda)
+resource "aws_iam_role_policy" "worker_workflow_permissions" {
+  count = var.workflow_state_machine_arn != null ? 1 : 0
+  name  = "${var.environment}-${replace(var.project_name, "service", "worker")}-workflow-policy"
+  role  = aws_iam_role.worker_lambda_role.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Allow"
+        Action = [
+          "states:StartExecution"
+        ]
+        Resource = [
+          var.workflow_state_machine_arn
+        ]
+      },
+      {
+        Effect = "Allow"
+        Action = [
+          "states:DescribeExecution"
+        ]
+        Resource = [
+          "${replace(var.workflow_state_machine_arn, ":stateMachine:", ":execution:")}:*"
+        ]
+      }
+    ]
+  })
+}
+
+# Optional DynamoDB table through which worker execution environments share
+# open circuit breakers, keyed by downstream dependency
+resource "aws_dynamodb_table" "circuit_breaker" {
+  count        = var.enable_shared_circuit_breaker ? 1 : 0
+  name         = "${var.environment}-${replace(var.project_name, "service", "worker")}-circuit-breaker"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "dependency"
+
+  attribute {
+    name = "dependency"
+    type = "S"
+  }
+
+  ttl {
+    attribute_name = "expiresAt"
+    enabled        = true
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  tags = {
+    Name = "${var.environment}-${replace(var.project_name, "service", "worker")}-circuit-breaker"
+  }
+}
+
+resource "aws_iam_role_policy" "worker_circuit_breaker_permissions" {
+  count = var.enable_shared_circuit_breaker ? 1 : 0
+  name  = "${var.environment}-${replace(var.project_name, "service", "worker")}-circuit-breaker-policy"
+  role  = aws_iam_role.worker_lambda_role.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Allow"
+        Action = [
+          "dynamodb:GetItem",
+          "dynamodb:PutItem"
+        ]
+        Resource = [
+          aws_dynamodb_table.circuit_breaker[0].arn
+        ]
+      }
+    ]
+  })
+}
+
+# Token buckets shared by all worker instances when rate_limit_mode is
+# shared, keyed by work type
+resource "aws_dynamodb_table" "rate_limit" {
+  count        = var.rate_limit_mode == "shared" ? 1 : 0
+  name         = "${var.environment}-${replace(var.project_name, "service", "worker")}-rate-limit"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "workType"
+
+  attribute {
+    name = "workType"
+    type = "S"
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  tags = {
+    Name = "${var.environment}-${replace(var.project_name, "service", "worker")}-rate-limit"
+  }
+}
+
+resource "aws_iam_role_policy" "worker_rate_limit_permissions" {
+  count = var.rate_limit_mode == "shared" ? 1 : 0
+  name  = "${var.environment}-${replace(var.project_name, "service", "worker")}-rate-limit-policy"
+  role  = aws_iam_role.worker_lambda_role.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Allow"
+        Action = [
+          "dynamodb:GetItem",
+          "dynamodb:UpdateItem"
+        ]
+        Resource = [
+          aws_dynamodb_table.rate_limit[0].arn
+        ]
+      }
+    ]
+  })
+}
+
+# Runtime pause list and kill switch read by both functions. Operators edit
+# the value during incidents, for example:
+#   {"killSwitch": false, "paused": {"backup_task": "skip"}}
+resource "aws_ssm_parameter" "work_pauses" {
+  name        = "/${var.environment}/${var.project_name}/work-pauses"
+  description = "Paused work types and kill switch for the producer and worker"
+  type        = "String"
+  value       = jsonencode({ killSwitch = false, paused = {} })
+
+  lifecycle {
+    ignore_changes = [value]
+  }
+}
+
+resource "aws_iam_role_policy" "pause_parameter_permissions" {
+  name = "${var.environment}-${var.project_name}-pause-parameter-policy"
+  role = aws_iam_role.lambda_role.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Allow"
+        Action = [
+          "ssm:GetParameter"
+        ]
+        Resource = [
+          aws_ssm_parameter.work_pauses.arn
+        ]
+      }
+    ]
+  })
+}
+
+resource "aws_iam_role_policy" "worker_pause_parameter_permissions" {
+  name = "${var.environment}-${replace(var.project_name, "service", "worker")}-pause-parameter-policy"
+  role = aws_iam_role.worker_lambda_role.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Allow"
+        Action = [
+          "ssm:GetParameter"
+        ]
+        Resource = [
+          aws_ssm_parameter.work_pauses.arn
+        ]
+      }
+    ]
+  })
+}
+
+# Remote write to an Amazon Managed Service for Prometheus workspace, signed
+# with the functions' own roles
+resource "aws_iam_role_policy" "prometheus_remote_write_permissions" {
+  count = var.prometheus_workspace_arn != null ? 1 : 0
+  name  = "${var.environment}-${var.project_name}-prometheus-policy"
+  role  = aws_iam_role.lambda_role.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Allow"
+        Action = [
+          "aps:RemoteWrite"
+        ]
+        Resource = [
+          var.prometheus_workspace_arn
+        ]
+      }
+    ]
+  })
+}
+
+resource "aws_iam_role_policy" "worker_prometheus_remote_write_permissions" {
+  count = var.prometheus_workspace_arn != null ? 1 : 0
+  name  = "${var.environment}-${replace(var.project_name, "service", "worker")}-prometheus-policy"
+  role  = aws_iam_role.worker_lambda_role.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Allow"
+        Action = [
+          "aps:RemoteWrite"
+        ]
+        Resource = [
+          var.prometheus_workspace_arn
+        ]
+      }
+    ]
+  })
+}
+
+# S3 bucket holding metrics spooled while InfluxDB is unreachable; without it
+# each execution environment spools to its own /tmp
+resource "aws_s3_bucket" "metrics_spool" {
+  count  = var.enable_metrics_spool_bucket ? 1 : 0
+  bucket = "${var.environment}-${var.project_name}-metrics-spool-${data.aws_caller_identity.current.account_id}"
+
+  tags = {
+    Name = "${var.environment}-${var.project_name}-metrics-spool"
+  }
+}
+
+resource "aws_s3_bucket_server_side_encryption_configuration" "metrics_spool" {
+  count  = var.enable_metrics_spool_bucket ? 1 : 0
+  bucket = aws_s3_bucket.metrics_spool[0].id
+
+  rule {
+    apply_server_side_encryption_by_default {
+      sse_algorithm = "AES256"
+    }
+  }
+}
+
+resource "aws_s3_bucket_public_access_block" "metrics_spool" {
+  count  = var.enable_metrics_spool_bucket ? 1 : 0
+  bucket = aws_s3_bucket.metrics_spool[0].id
+
+  block_public_acls       = true
+  block_public_policy     = true
+  ignore_public_acls      = true
+  restrict_public_buckets = true
+}
+
+# Points older than InfluxDB's retention are not worth replaying
+resource "aws_s3_bucket_lifecycle_configuration" "metrics_spool" {
+  count  = var.enable_metrics_spool_bucket ? 1 : 0
+  bucket = aws_s3_bucket.metrics_spool[0].id
+
+  rule {
+    id     = "expire-spooled-metrics"
+    status = "Enabled"
+
+    filter {
+      prefix = "metrics-spool/"
+    }
+
+    expiration {
+      days = var.metrics_spool_retention_days
+    }
+  }
+}
+
+resource "aws_iam_role_policy" "metrics_spool_permissions" {
+  count = var.enable_metrics_spool_bucket ? 1 : 0
+  name  = "${var.environment}-${var.project_name}-metrics-spool-policy"
+  role  = aws_iam_role.lambda_role.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Allow"
+        Action = [
+          "s3:PutObject",
+          "s3:GetObject",
+          "s3:DeleteObject"
+        ]
+        Resource = [
+          "${aws_s3_bucket.metrics_spool[0].arn}/metrics-spool/*"
+        ]
+      },
+      {
+        Effect = "Allow"
+        Action = [
+          "s3:ListBucket"
+        ]
+        Resource = [
+          aws_s3_bucket.metrics_spool[0].arn
+        ]
+      }
+    ]
+  })
+}
+
+resource "aws_iam_role_policy" "worker_metrics_spool_permissions" {
+  count = var.enable_metrics_spool_bucket ? 1 : 0
+  name  = "${var.environment}-${replace(var.project_name, "service", "worker")}-metrics-spool-policy"
+  role  = aws_iam_role.worker_lambda_role.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Allow"
+        Action = [
+          "s3:PutObject",
+          "s3:GetObject",
+          "s3:DeleteObject"
+        ]
+        Resource = [
+          "${aws_s3_bucket.metrics_spool[0].arn}/metrics-spool/*"
+        ]
+      },
+      {
+        Effect = "Allow"
+        Action = [
+          "s3:ListBucket"
+        ]
+        Resource = [
+          aws_s3_bucket.metrics_spool[0].arn
+        ]
+      }
+    ]
+  })
+}
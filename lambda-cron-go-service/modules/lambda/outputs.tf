@@ -51,4 +51,39 @@ output "sqs_dlq_url" {
 output "sqs_dlq_arn" {
   description = "ARN of the SQS dead letter queue"
   value       = aws_sqs_queue.work_queue_dlq.arn
-}
\ No newline at end of file
+}
+
+output "reports_bucket_name" {
+  description = "Name of the S3 bucket holding generated reports"
+  value       = aws_s3_bucket.reports.id
+}
+
+output "status_table_name" {
+  description = "Name of the DynamoDB table tracking work item status"
+  value       = aws_dynamodb_table.work_item_status.name
+}
+
+output "status_api_url" {
+  description = "Function URL of the work item status API"
+  value       = aws_lambda_function_url.status_api.function_url
+}
+
+output "circuit_breaker_table_name" {
+  description = "Name of the DynamoDB table sharing worker circuit breaker state (null when disabled)"
+  value       = var.enable_shared_circuit_breaker ? aws_dynamodb_table.circuit_breaker[0].name : null
+}
+
+output "rate_limit_table_name" {
+  description = "Name of the DynamoDB table holding shared rate limit buckets (null unless rate_limit_mode is shared)"
+  value       = var.rate_limit_mode == "shared" ? aws_dynamodb_table.rate_limit[0].name : null
+}
+
+output "pause_parameter_name" {
+  description = "Name of the SSM parameter holding the work type pause list and kill switch"
+  value       = aws_ssm_parameter.work_pauses.name
+}
+
+output "metrics_spool_bucket_name" {
+  description = "Name of the S3 bucket holding spooled metrics, if enabled"
+  value       = var.enable_metrics_spool_bucket ? aws_s3_bucket.metrics_spool[0].id : null
+}
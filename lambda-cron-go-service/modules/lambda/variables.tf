@@ -51,6 +51,12 @@ variable "worker_image_uri" {
   default     = null
 }
 
+variable "status_api_image_uri" {
+  description = "ECR image URI for status API Lambda function (optional, defaults to main image_uri)"
+  type        = string
+  default     = null
+}
+
 variable "worker_timeout" {
   description = "Worker Lambda function timeout in seconds (optional, defaults to main timeout)"
   type        = number
@@ -72,4 +78,234 @@ variable "sqs_batch_size" {
 variable "influxdb_secret_arn" {
   description = "ARN of the AWS Secrets Manager secret containing InfluxDB credentials"
   type        = string
-}
\ No newline at end of file
+}
+
+variable "database_secret_arn" {
+  description = "ARN of the AWS Secrets Manager secret containing Postgres credentials for the worker (optional)"
+  type        = string
+  default     = null
+}
+
+variable "completion_event_target" {
+  description = "Where the worker publishes work item completion events (eventbridge, sns or none)"
+  type        = string
+  default     = "none"
+
+  validation {
+    condition     = contains(["eventbridge", "sns", "none"], var.completion_event_target)
+    error_message = "completion_event_target must be eventbridge, sns or none."
+  }
+}
+
+variable "completion_event_bus_name" {
+  description = "EventBridge bus for completion events when completion_event_target is eventbridge"
+  type        = string
+  default     = "default"
+}
+
+variable "completion_event_topic_arn" {
+  description = "SNS topic ARN for completion events when completion_event_target is sns"
+  type        = string
+  default     = null
+}
+
+variable "workflow_state_machine_arn" {
+  description = "ARN of the Step Functions state machine started by workflow work items (optional)"
+  type        = string
+  default     = null
+}
+
+variable "circuit_breaker_failure_threshold" {
+  description = "Consecutive transient failures of a downstream dependency before the worker's circuit breaker opens"
+  type        = number
+  default     = 5
+}
+
+variable "circuit_breaker_cooldown_seconds" {
+  description = "How long an open circuit breaker fails calls fast before letting a trial call through"
+  type        = number
+  default     = 30
+}
+
+variable "enable_shared_circuit_breaker" {
+  description = "Share open circuit breakers between worker execution environments through a DynamoDB table"
+  type        = bool
+  default     = false
+}
+
+variable "rate_limits" {
+  description = "Per work type throughput caps for the worker; items over the limit are deferred on the queue"
+  type = map(object({
+    rate_per_second = number
+    burst           = optional(number, 0)
+  }))
+  default = {}
+}
+
+variable "rate_limit_mode" {
+  description = "Whether rate limits apply per worker instance (local) or across all instances through DynamoDB (shared)"
+  type        = string
+  default     = "local"
+
+  validation {
+    condition     = contains(["local", "shared"], var.rate_limit_mode)
+    error_message = "rate_limit_mode must be local or shared."
+  }
+}
+
+variable "drain_safety_margin_seconds" {
+  description = "Time the worker keeps in reserve before its timeout; records not started by then are returned to the queue"
+  type        = number
+  default     = 15
+}
+
+variable "visibility_heartbeat_seconds" {
+  description = "How often the worker extends the visibility of a message whose work item is still running"
+  type        = number
+  default     = 60
+}
+
+variable "named_schedules" {
+  description = "EventBridge schedule expressions keyed by the schedule name defined in the producer's schedules.json"
+  type        = map(string)
+  default     = {}
+}
+
+variable "pause_cache_ttl_seconds" {
+  description = "How long the producer and worker cache the pause list before reading it again"
+  type        = number
+  default     = 30
+}
+
+variable "pause_hold_seconds" {
+  description = "How long the worker hides a message of a paused work type before checking again"
+  type        = number
+  default     = 900
+}
+
+variable "secret_cache_ttl_seconds" {
+  description = "How long warm invocations reuse a secret read from Secrets Manager before reading it again"
+  type        = number
+  default     = 300
+}
+
+variable "metrics_sinks" {
+  description = "Metrics backends for the producer and worker: influxdb, emf (CloudWatch Embedded Metric Format), prometheus or none"
+  type        = list(string)
+  default     = ["influxdb"]
+
+  validation {
+    condition     = alltrue([for sink in var.metrics_sinks : contains(["influxdb", "emf", "prometheus", "none"], sink)])
+    error_message = "metrics_sinks may only contain influxdb, emf, prometheus and none."
+  }
+}
+
+variable "metrics_fallback_sink" {
+  description = "Metrics backend used in place of a sink that cannot be set up, such as InfluxDB when its secret cannot be read; such runs log METRICS_DEGRADED"
+  type        = string
+  default     = "emf"
+
+  validation {
+    condition     = contains(["emf", "prometheus", "none"], var.metrics_fallback_sink)
+    error_message = "metrics_fallback_sink must be emf, prometheus or none."
+  }
+}
+
+variable "metrics_schema_mode" {
+  description = "How points outside the metrics schema are handled: enforce (undeclared tags become fields and are logged) or strict (such points are dropped and counted as failed metrics writes)"
+  type        = string
+  default     = "enforce"
+
+  validation {
+    condition     = contains(["enforce", "strict"], var.metrics_schema_mode)
+    error_message = "metrics_schema_mode must be enforce or strict."
+  }
+}
+
+variable "metrics_namespace" {
+  description = "CloudWatch namespace for metrics written in Embedded Metric Format"
+  type        = string
+  default     = "LambdaCronGo"
+}
+
+variable "prometheus_remote_write_url" {
+  description = "Prometheus remote-write endpoint for the prometheus metrics sink"
+  type        = string
+  default     = null
+}
+
+variable "prometheus_workspace_arn" {
+  description = "Amazon Managed Service for Prometheus workspace behind prometheus_remote_write_url; requests are then signed with SigV4"
+  type        = string
+  default     = null
+}
+
+variable "metrics_error_policy" {
+  description = "What failed metrics writes do to a run: ignore (only counted in the response), warn (also logged) or fail (the producer run fails; the worker hands back the records whose metrics were lost)"
+  type        = string
+  default     = "warn"
+
+  validation {
+    condition     = contains(["ignore", "warn", "fail"], var.metrics_error_policy)
+    error_message = "metrics_error_policy must be ignore, warn or fail."
+  }
+}
+
+variable "enable_metrics_spool_bucket" {
+  description = "Spool metrics InfluxDB cannot take to an S3 bucket shared by both functions, instead of each execution environment's /tmp"
+  type        = bool
+  default     = false
+}
+
+variable "metrics_spool_retention_days" {
+  description = "Days spooled metrics are kept in the spool bucket before they expire unreplayed"
+  type        = number
+  default     = 7
+}
+
+variable "metrics_spool_max_mb" {
+  description = "Megabytes of spooled metrics each execution environment keeps in /tmp when there is no spool bucket; the oldest batches are dropped beyond it"
+  type        = number
+  default     = 128
+}
+
+variable "redact_keys" {
+  description = "Payload, log and metric keys to redact on top of email, notifyEmail, recipient, phone and userId; suffix a key with :hash or :mask to override redaction_mode"
+  type        = list(string)
+  default     = []
+}
+
+variable "redaction_mode" {
+  description = "How redacted values are written: hash (stable, so lines can still be correlated) or mask"
+  type        = string
+  default     = "hash"
+
+  validation {
+    condition     = contains(["hash", "mask"], var.redaction_mode)
+    error_message = "redaction_mode must be hash or mask."
+  }
+}
+
+variable "redaction_hash_key" {
+  description = "HMAC key for hashed values; without it values are plain SHA-256 hashes, which can be guessed for user IDs"
+  type        = string
+  default     = null
+  sensitive   = true
+}
+
+variable "tracing_exporter" {
+  description = "Where both functions export traces: otlp (a collector, such as the ADOT Lambda layer), file (JSON lines in /tmp, for debugging) or none"
+  type        = string
+  default     = "none"
+
+  validation {
+    condition     = contains(["otlp", "file", "none"], var.tracing_exporter)
+    error_message = "tracing_exporter must be otlp, file or none."
+  }
+}
+
+variable "otlp_endpoint" {
+  description = "OTLP/HTTP endpoint traces are sent to when tracing_exporter is otlp; defaults to a collector on localhost:4318"
+  type        = string
+  default     = null
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	// Embedded zone data, since the Lambda base image may not ship it
+	_ "time/tzdata"
+)
+
+// Reasons recorded when calendar rules skip a run.
+const (
+	skipNonBusinessDay = "non_business_day"
+	skipOutsideHours   = "outside_hours"
+	skipBlackout       = "blackout"
+)
+
+// CalendarRules limit when a schedule may run beyond its cron or
+// EventBridge expression. They are evaluated in Timezone (UTC by default)
+// each time the schedule fires.
+type CalendarRules struct {
+	Timezone string `json:"timezone,omitempty"`
+	// BusinessDayCalendar is a calendar file; runs on its weekend days and
+	// holidays are skipped
+	BusinessDayCalendar string `json:"businessDayCalendar,omitempty"`
+	// Hours lists the local hours runs are allowed in, so a UTC rule can
+	// cover both sides of a daylight saving change
+	Hours     []int            `json:"hours,omitempty"`
+	Blackouts []BlackoutWindow `json:"blackouts,omitempty"`
+
+	location *time.Location
+}
+
+// BlackoutWindow is a period in which runs are skipped: either a one-off
+// range between From and Until, or a daily StartTime-EndTime window,
+// optionally restricted to Weekdays. Times are local to the rules'
+// timezone.
+type BlackoutWindow struct {
+	Name      string   `json:"name"`
+	From      string   `json:"from,omitempty"`
+	Until     string   `json:"until,omitempty"`
+	Weekdays  []string `json:"weekdays,omitempty"`
+	StartTime string   `json:"startTime,omitempty"`
+	EndTime   string   `json:"endTime,omitempty"`
+
+	from  time.Time
+	until time.Time
+	start time.Duration
+	end   time.Duration
+}
+
+// BusinessDayCalendar is a calendar file: the weekdays that are not
+// business days (Saturday and Sunday by default) and dated holidays.
+type BusinessDayCalendar struct {
+	Name     string   `json:"name"`
+	Weekend  []string `json:"weekend,omitempty"`
+	Holidays []string `json:"holidays"`
+
+	weekend  map[time.Weekday]bool
+	holidays map[string]bool
+}
+
+const (
+	calendarDateLayout     = "2006-01-02"
+	calendarDateTimeLayout = "2006-01-02T15:04"
+)
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+var (
+	businessCalendarsMu sync.Mutex
+	businessCalendars   = map[string]*BusinessDayCalendar{}
+)
+
+// validate parses the rules' timezone, times and calendar file.
+func (c *CalendarRules) validate() error {
+	location, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return fmt.Errorf("invalid timezone %q: %w", c.Timezone, err)
+	}
+	c.location = location
+
+	for _, hour := range c.Hours {
+		if hour < 0 || hour > 23 {
+			return fmt.Errorf("invalid hour %d", hour)
+		}
+	}
+
+	if c.BusinessDayCalendar != "" {
+		if _, err := loadBusinessDayCalendar(c.BusinessDayCalendar); err != nil {
+			return err
+		}
+	}
+
+	for i := range c.Blackouts {
+		if err := c.Blackouts[i].parse(location); err != nil {
+			return fmt.Errorf("blackout %q: %w", c.Blackouts[i].Name, err)
+		}
+	}
+
+	return nil
+}
+
+// skipReason returns why a run at now is not allowed, or an empty string if
+// it may go ahead.
+func (c *CalendarRules) skipReason(now time.Time) (string, error) {
+	local := now.In(c.location)
+
+	if c.BusinessDayCalendar != "" {
+		calendar, err := loadBusinessDayCalendar(c.BusinessDayCalendar)
+		if err != nil {
+			return "", err
+		}
+		if !calendar.isBusinessDay(local) {
+			return skipNonBusinessDay, nil
+		}
+	}
+
+	if len(c.Hours) > 0 {
+		allowed := false
+		for _, hour := range c.Hours {
+			if local.Hour() == hour {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return skipOutsideHours, nil
+		}
+	}
+
+	for _, blackout := range c.Blackouts {
+		if blackout.contains(local) {
+			return skipBlackout + ":" + blackout.Name, nil
+		}
+	}
+
+	return "", nil
+}
+
+func (w *BlackoutWindow) parse(location *time.Location) error {
+	if w.Name == "" {
+		return fmt.Errorf("blackout windows need a name")
+	}
+
+	if w.From != "" || w.Until != "" {
+		var err error
+		if w.from, err = time.ParseInLocation(calendarDateTimeLayout, w.From, location); err != nil {
+			return fmt.Errorf("invalid from: %w", err)
+		}
+		if w.until, err = time.ParseInLocation(calendarDateTimeLayout, w.Until, location); err != nil {
+			return fmt.Errorf("invalid until: %w", err)
+		}
+		if !w.until.After(w.from) {
+			return fmt.Errorf("until must be after from")
+		}
+		return nil
+	}
+
+	for _, day := range w.Weekdays {
+		if _, ok := weekdayNames[strings.ToLower(day)]; !ok {
+			return fmt.Errorf("unknown weekday %q", day)
+		}
+	}
+
+	var err error
+	if w.start, err = parseTimeOfDay(w.StartTime); err != nil {
+		return fmt.Errorf("invalid startTime: %w", err)
+	}
+	if w.end, err = parseTimeOfDay(w.EndTime); err != nil {
+		return fmt.Errorf("invalid endTime: %w", err)
+	}
+	if w.end <= w.start {
+		return fmt.Errorf("endTime must be after startTime")
+	}
+
+	return nil
+}
+
+func (w *BlackoutWindow) contains(local time.Time) bool {
+	if !w.from.IsZero() {
+		return !local.Before(w.from) && local.Before(w.until)
+	}
+
+	if len(w.Weekdays) > 0 {
+		matches := false
+		for _, day := range w.Weekdays {
+			if weekdayNames[strings.ToLower(day)] == local.Weekday() {
+				matches = true
+				break
+			}
+		}
+		if !matches {
+			return false
+		}
+	}
+
+	sinceMidnight := time.Duration(local.Hour())*time.Hour + time.Duration(local.Minute())*time.Minute
+	return sinceMidnight >= w.start && sinceMidnight < w.end
+}
+
+func parseTimeOfDay(value string) (time.Duration, error) {
+	parsed, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(parsed.Hour())*time.Hour + time.Duration(parsed.Minute())*time.Minute, nil
+}
+
+// loadBusinessDayCalendar reads a calendar file once per process.
+func loadBusinessDayCalendar(path string) (*BusinessDayCalendar, error) {
+	businessCalendarsMu.Lock()
+	defer businessCalendarsMu.Unlock()
+
+	if calendar, ok := businessCalendars[path]; ok {
+		return calendar, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read business day calendar: %w", err)
+	}
+
+	var calendar BusinessDayCalendar
+	if err := json.Unmarshal(data, &calendar); err != nil {
+		return nil, fmt.Errorf("failed to parse business day calendar %s: %w", path, err)
+	}
+
+	weekend := calendar.Weekend
+	if len(weekend) == 0 {
+		weekend = []string{"sat", "sun"}
+	}
+	calendar.weekend = make(map[time.Weekday]bool, len(weekend))
+	for _, day := range weekend {
+		weekday, ok := weekdayNames[strings.ToLower(day)]
+		if !ok {
+			return nil, fmt.Errorf("business day calendar %s has unknown weekday %q", path, day)
+		}
+		calendar.weekend[weekday] = true
+	}
+
+	calendar.holidays = make(map[string]bool, len(calendar.Holidays))
+	for _, holiday := range calendar.Holidays {
+		if _, err := time.Parse(calendarDateLayout, holiday); err != nil {
+			return nil, fmt.Errorf("business day calendar %s has invalid holiday %q", path, holiday)
+		}
+		calendar.holidays[holiday] = true
+	}
+
+	businessCalendars[path] = &calendar
+	return &calendar, nil
+}
+
+func (c *BusinessDayCalendar) isBusinessDay(local time.Time) bool {
+	return !c.weekend[local.Weekday()] && !c.holidays[local.Format(calendarDateLayout)]
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"lambda-cron-go-service/internal/workstatus"
+)
+
+// validateDependencies checks that every dependsOn reference names another
+// item of the same run and that the references contain no cycles.
+func validateDependencies(workItems []WorkItem) error {
+	byId := make(map[int]WorkItem, len(workItems))
+	for _, item := range workItems {
+		if _, exists := byId[item.ID]; exists {
+			return fmt.Errorf("duplicate work item ID %d", item.ID)
+		}
+		byId[item.ID] = item
+	}
+
+	for _, item := range workItems {
+		for _, dependency := range item.DependsOn {
+			if dependency == item.ID {
+				return fmt.Errorf("work item %d depends on itself", item.ID)
+			}
+			if _, exists := byId[dependency]; !exists {
+				return fmt.Errorf("work item %d depends on unknown work item %d", item.ID, dependency)
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[int]int, len(workItems))
+
+	var visit func(id int) error
+	visit = func(id int) error {
+		switch state[id] {
+		case visiting:
+			return fmt.Errorf("dependency cycle through work item %d", id)
+		case visited:
+			return nil
+		}
+
+		state[id] = visiting
+		for _, dependency := range byId[id].DependsOn {
+			if err := visit(dependency); err != nil {
+				return err
+			}
+		}
+		state[id] = visited
+		return nil
+	}
+
+	for _, item := range workItems {
+		if err := visit(item.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// recordPending stores a work item that waits on dependencies, including
+// its serialized body so the worker can enqueue it once released.
+func recordPending(ctx context.Context, store *workstatus.Store, item WorkItem) error {
+	body, err := json.Marshal(item)
+	if err != nil {
+		return fmt.Errorf("failed to marshal work item %d: %w", item.ID, err)
+	}
+
+	return store.Record(ctx, workstatus.Transition{
+		RunId:         item.RunId,
+		WorkId:        item.ID,
+		WorkType:      item.Type,
+		Status:        workstatus.Pending,
+		CorrelationId: item.CorrelationId,
+		DependsOn:     item.DependsOn,
+		Body:          string(body),
+	})
+}
@@ -0,0 +1,17 @@
+// Package env reads the numeric settings the producer and worker take from
+// their environment.
+package env
+
+import (
+	"os"
+	"strconv"
+)
+
+// Int reads a positive integer setting, falling back when it is unset or
+// invalid.
+func Int(name string, fallback int) int {
+	if value, err := strconv.Atoi(os.Getenv(name)); err == nil && value > 0 {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,151 @@
+// Package pause reads the runtime-controlled pause list the producer and
+// worker share.
+package pause
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+
+	"lambda-cron-go-service/internal/env"
+	"lambda-cron-go-service/internal/telemetry"
+)
+
+const defaultCacheTTL = 30 * time.Second
+
+// Config is the pause list kept in the SSM parameter named by
+// PAUSE_PARAMETER_NAME. Paused maps a work type to "skip", which stops the
+// producer sending it, or "hold", which the producer still sends; the
+// worker holds paused items of either kind on the queue. KillSwitch skips
+// whole runs and holds everything already queued.
+type Config struct {
+	KillSwitch bool              `json:"killSwitch"`
+	Paused     map[string]string `json:"paused"`
+}
+
+var (
+	mu        sync.Mutex
+	current   Config
+	fetchedAt time.Time
+)
+
+// Mode returns "skip" or "hold" for a paused work type, or an empty string
+// if it is not paused.
+func (c Config) Mode(workType string) string {
+	mode, paused := c.Paused[workType]
+	if !paused {
+		return ""
+	}
+	if mode != "skip" {
+		return "hold"
+	}
+	return mode
+}
+
+// Current returns the pause list, cached for PAUSE_CACHE_TTL_SECONDS. If it
+// cannot be read the last known list stays in force. Changes are recorded
+// as work_type_pause points tagged with component.
+func Current(ctx context.Context, component string, metrics telemetry.MetricsSink) Config {
+	parameterName := os.Getenv("PAUSE_PARAMETER_NAME")
+	if parameterName == "" {
+		return Config{}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	ttl := time.Duration(env.Int("PAUSE_CACHE_TTL_SECONDS", int(defaultCacheTTL.Seconds()))) * time.Second
+	if !fetchedAt.IsZero() && time.Since(fetchedAt) < ttl {
+		return current
+	}
+
+	latest, err := fetch(ctx, parameterName)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to refresh pause list, keeping the last known one", "error", err)
+		return current
+	}
+
+	recordChanges(current, latest, component, metrics)
+	current = latest
+	fetchedAt = time.Now()
+
+	return current
+}
+
+func fetch(ctx context.Context, parameterName string) (Config, error) {
+	cfg, err := telemetry.GetAWSConfig(ctx)
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	result, err := ssm.NewFromConfig(cfg).GetParameter(ctx, &ssm.GetParameterInput{
+		Name: aws.String(parameterName),
+	})
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to read pause parameter %s: %w", parameterName, err)
+	}
+
+	var config Config
+	if err := json.Unmarshal([]byte(aws.ToString(result.Parameter.Value)), &config); err != nil {
+		return Config{}, fmt.Errorf("failed to parse pause parameter %s: %w", parameterName, err)
+	}
+
+	return config, nil
+}
+
+// recordChanges logs and records every difference between two pause lists.
+func recordChanges(previous Config, latest Config, component string, metrics telemetry.MetricsSink) {
+	changes := map[string]string{}
+
+	if previous.KillSwitch != latest.KillSwitch {
+		changes["*"] = state(latest.KillSwitch, "hold")
+	}
+
+	for workType, mode := range latest.Paused {
+		if previous.Paused[workType] != mode {
+			changes[workType] = state(true, mode)
+		}
+	}
+	for workType := range previous.Paused {
+		if _, ok := latest.Paused[workType]; !ok {
+			changes[workType] = state(false, "")
+		}
+	}
+
+	workTypes := make([]string, 0, len(changes))
+	for workType := range changes {
+		workTypes = append(workTypes, workType)
+	}
+	sort.Strings(workTypes)
+
+	for _, workType := range workTypes {
+		slog.Info("Pause state changed", "work_type", workType, "state", changes[workType])
+
+		// Record pause state change
+		metrics.Event("work_type_pause", telemetry.Tags{
+			"work_type": workType,
+			"state":     changes[workType],
+			"component": component,
+		}, telemetry.Fields{
+			"paused": changes[workType] != "active",
+		})
+	}
+}
+
+func state(paused bool, mode string) string {
+	if !paused {
+		return "active"
+	}
+	if mode == "skip" {
+		return "paused_skip"
+	}
+	return "paused_hold"
+}
@@ -0,0 +1,34 @@
+package telemetry
+
+import (
+	"context"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+)
+
+var (
+	awsConfigMu sync.Mutex
+	awsConfig   *aws.Config
+)
+
+// GetAWSConfig loads the default AWS config once per execution environment,
+// so warm invocations reuse its resolved region and cached credentials.
+func GetAWSConfig(ctx context.Context) (aws.Config, error) {
+	awsConfigMu.Lock()
+	defer awsConfigMu.Unlock()
+
+	if awsConfig != nil {
+		return *awsConfig, nil
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return aws.Config{}, err
+	}
+	cfg.APIOptions = append(cfg.APIOptions, traceAWSCalls)
+
+	awsConfig = &cfg
+	return cfg, nil
+}
@@ -0,0 +1,376 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api"
+	http2 "github.com/influxdata/influxdb-client-go/v2/api/http"
+	lp "github.com/influxdata/line-protocol"
+)
+
+// influxIdleReset is how long the client may sit unused before its pooled
+// connections are dropped. Lambda freezes the environment between
+// invocations, and connections kept open across a long freeze have usually
+// been closed by the server or a load balancer in the meantime.
+const influxIdleReset = 30 * time.Second
+
+const (
+	// influxBatchSize caps the points sent in one write request
+	influxBatchSize = 5000
+	// influxWriteTimeout bounds the write, and then the replay, of each
+	// Flush
+	influxWriteTimeout = 20 * time.Second
+)
+
+// influxDependency is the name InfluxDB writes go through the service's
+// circuit breaker under.
+const influxDependency = "influxdb"
+
+// errInfluxCircuitOpen fails writes the circuit breaker holds back. Like
+// any other failure to reach InfluxDB, their points are spooled.
+var errInfluxCircuitOpen = errors.New("InfluxDB circuit breaker is open")
+
+// influxRejectedError reports the points InfluxDB refused out of a write
+// whose other points it took.
+type influxRejectedError struct {
+	points int
+	total  int
+	err    error
+}
+
+func (e *influxRejectedError) Error() string {
+	return fmt.Sprintf("InfluxDB rejected %d of %d points: %v", e.points, e.total, e.err)
+}
+
+func (e *influxRejectedError) Unwrap() error {
+	return e.err
+}
+
+// influxCredentials is the JSON secret named by INFLUXDB_SECRET_ARN.
+type influxCredentials struct {
+	Token string `json:"token"`
+}
+
+type influxConnection struct {
+	client    influxdb2.Client
+	writeAPI  api.WriteAPIBlocking
+	transport *http.Transport
+	secretArn string
+	lastUsed  time.Time
+}
+
+var (
+	influxMu   sync.Mutex
+	influxConn *influxConnection
+	// influxDown is why the last Flush had to spool, or nil when it did not
+	influxDown error
+)
+
+// getInfluxConnection returns the InfluxDB connection for this execution
+// environment, creating the client on first use so warm invocations reuse
+// the client, its connections and the cached token.
+func getInfluxConnection(ctx context.Context) (*influxConnection, error) {
+	influxMu.Lock()
+	defer influxMu.Unlock()
+
+	if influxConn != nil {
+		// Wall clock time, since the monotonic clock does not advance while
+		// the environment is frozen
+		if time.Now().Round(0).Sub(influxConn.lastUsed) > influxIdleReset {
+			influxConn.transport.CloseIdleConnections()
+		}
+		influxConn.lastUsed = time.Now().Round(0)
+		return influxConn, nil
+	}
+
+	// Get InfluxDB credentials from AWS Secrets Manager
+	secretArn := os.Getenv("INFLUXDB_SECRET_ARN")
+	secret, err := GetSecret(ctx, secretArn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve secret: %w", err)
+	}
+
+	var credentials influxCredentials
+	if err := json.Unmarshal([]byte(secret), &credentials); err != nil {
+		return nil, fmt.Errorf("failed to parse credentials: %w", err)
+	}
+
+	influxURL := os.Getenv("INFLUXDB_URL")
+	influxOrg := os.Getenv("INFLUXDB_ORG")
+	influxBucket := os.Getenv("INFLUXDB_BUCKET")
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	// Initialize InfluxDB client
+	client := influxdb2.NewClientWithOptions(
+		influxURL,
+		credentials.Token,
+		influxdb2.DefaultOptions().
+			SetUseGZip(true).
+			SetHTTPClient(&http.Client{Transport: transport, Timeout: influxWriteTimeout}),
+	)
+
+	influxConn = &influxConnection{
+		client:    client,
+		writeAPI:  client.WriteAPIBlocking(influxOrg, influxBucket),
+		transport: transport,
+		secretArn: secretArn,
+		lastUsed:  time.Now().Round(0),
+	}
+	slog.InfoContext(ctx, "Connected to InfluxDB", "url", influxURL, "organization", influxOrg, "bucket", influxBucket)
+
+	return influxConn, nil
+}
+
+// dropInfluxConnection discards a connection whose token InfluxDB rejected
+// along with the cached secret, so the next getInfluxConnection picks up a
+// rotated token without waiting for the secret cache to expire.
+func dropInfluxConnection(conn *influxConnection) {
+	influxMu.Lock()
+	defer influxMu.Unlock()
+
+	if influxConn == conn {
+		InvalidateSecret(conn.secretArn)
+		conn.transport.CloseIdleConnections()
+		influxConn = nil
+	}
+}
+
+// influxUnavailable returns why the last Flush spooled its points, or nil
+// when InfluxDB took them.
+func influxUnavailable() error {
+	influxMu.Lock()
+	defer influxMu.Unlock()
+
+	return influxDown
+}
+
+func setInfluxUnavailable(err error) {
+	influxMu.Lock()
+	defer influxMu.Unlock()
+
+	influxDown = err
+}
+
+func isInfluxAuthError(err error) bool {
+	var httpErr *http2.Error
+	return errors.As(err, &httpErr) &&
+		(httpErr.StatusCode == http.StatusUnauthorized || httpErr.StatusCode == http.StatusForbidden)
+}
+
+// influxSink records to InfluxDB. Events are written as points with the
+// event's tags and fields, counters and gauges as a "value" field and
+// timings as "duration_ms".
+//
+// Points are kept as line protocol and written on Flush with the blocking
+// write API, so every failed write is reported back to the invocation
+// rather than lost in the background. Points InfluxDB cannot take because
+// it is unreachable or unhealthy, or its secret cannot be read, are spooled
+// and replayed by a later Flush, and the sink reports itself degraded until
+// then.
+type influxSink struct {
+	mu    sync.Mutex
+	lines []string
+	errs  []error
+}
+
+func (s *influxSink) Counter(name string, value float64, tags Tags) {
+	s.Event(name, tags, Fields{"value": value})
+}
+
+func (s *influxSink) Gauge(name string, value float64, tags Tags) {
+	s.Event(name, tags, Fields{"value": value})
+}
+
+func (s *influxSink) Timing(name string, duration time.Duration, tags Tags) {
+	s.Event(name, tags, Fields{"duration_ms": duration.Milliseconds()})
+}
+
+func (s *influxSink) Event(name string, tags Tags, fields Fields) {
+	point := influxdb2.NewPointWithMeasurement(name).SetTime(time.Now())
+	for key, value := range tags {
+		point.AddTag(key, value)
+	}
+	for key, value := range fields {
+		point.AddField(key, value)
+	}
+
+	var buffer bytes.Buffer
+	encoder := lp.NewEncoder(&buffer)
+	encoder.SetFieldTypeSupport(lp.UintSupport)
+	encoder.FailOnFieldErr(true)
+	encoder.SetPrecision(time.Nanosecond)
+	_, err := encoder.Encode(point)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err != nil {
+		s.errs = append(s.errs, fmt.Errorf("failed to encode %s point: %w", name, err))
+		return
+	}
+	s.lines = append(s.lines, strings.TrimSuffix(buffer.String(), "\n"))
+}
+
+// Flush writes the buffered points. When InfluxDB cannot take them they are
+// spooled instead, and once a write succeeds anything spooled earlier is
+// replayed. Points InfluxDB rejects are dropped and reported.
+func (s *influxSink) Flush(ctx context.Context) error {
+	s.mu.Lock()
+	lines, errs := s.lines, s.errs
+	s.lines, s.errs = nil, nil
+	s.mu.Unlock()
+
+	if len(lines) == 0 {
+		return errors.Join(errs...)
+	}
+
+	writeCtx, cancel := writeContext(ctx, influxWriteTimeout)
+	defer cancel()
+
+	err := sendInfluxLines(writeCtx, lines)
+	if err == nil || isInfluxUnavailable(err) {
+		setInfluxUnavailable(err)
+	}
+
+	var rejected *influxRejectedError
+	if errors.As(err, &rejected) {
+		// The rest of the points were written
+		setInfluxUnavailable(nil)
+		errs = append(errs, err)
+	} else if err != nil {
+		if !isInfluxUnavailable(err) {
+			errs = append(errs, fmt.Errorf("failed to write %d points to InfluxDB: %w", len(lines), err))
+			return errors.Join(errs...)
+		}
+
+		location, spoolErr := getMetricsSpool(writeCtx).Save(context.WithoutCancel(writeCtx), lines)
+		if spoolErr != nil {
+			errs = append(errs, fmt.Errorf("failed to write %d points to InfluxDB: %w (spooling them failed: %v)", len(lines), err, spoolErr))
+			return errors.Join(errs...)
+		}
+
+		slog.Warn("InfluxDB is unavailable, spooled points for replay", "points", len(lines), "location", location, "error", err)
+		return errors.Join(errs...)
+	}
+
+	// InfluxDB is reachable again, so catch up on earlier spooled points
+	// in whatever time the caller has left
+	replayCtx, cancelReplay := writeContext(ctx, influxWriteTimeout)
+	defer cancelReplay()
+
+	if _, err := replaySpooledMetrics(replayCtx, sendInfluxLines); err != nil {
+		slog.Warn("Metrics spool replay stopped, it will continue on a later flush", "error", err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// sendInfluxLines writes line protocol to InfluxDB through the service's
+// circuit breaker, when it has one. A rejected token is refreshed and the
+// write retried once.
+func sendInfluxLines(ctx context.Context, lines []string) error {
+	breaker := service.Breaker
+	if breaker == nil {
+		return refreshAndWriteInfluxLines(ctx, lines)
+	}
+
+	metrics := currentMetricsSink()
+	if !breaker.Allow(ctx, influxDependency, metrics) {
+		return errInfluxCircuitOpen
+	}
+
+	err := refreshAndWriteInfluxLines(ctx, lines)
+	breaker.Record(ctx, influxDependency, metrics, err == nil || !isInfluxUnavailable(err))
+	return err
+}
+
+func refreshAndWriteInfluxLines(ctx context.Context, lines []string) error {
+	conn, err := getInfluxConnection(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = writeInfluxLines(ctx, conn, lines)
+	if isInfluxAuthError(err) {
+		slog.WarnContext(ctx, "InfluxDB rejected the token, refreshing credentials", "error", err)
+		dropInfluxConnection(conn)
+
+		if conn, err = getInfluxConnection(ctx); err == nil {
+			err = writeInfluxLines(ctx, conn, lines)
+		}
+	}
+	return err
+}
+
+// writeInfluxLines writes lines in batches of influxBatchSize. A batch
+// InfluxDB rejects is split in halves until the points it refuses are
+// isolated, so only those are dropped, reported as an influxRejectedError.
+func writeInfluxLines(ctx context.Context, conn *influxConnection, lines []string) error {
+	var rejected []error
+	for start := 0; start < len(lines); start += influxBatchSize {
+		end := min(start+influxBatchSize, len(lines))
+		if err := writeInfluxBatch(ctx, conn, lines[start:end], &rejected); err != nil {
+			return err
+		}
+	}
+
+	if len(rejected) > 0 {
+		return &influxRejectedError{points: len(rejected), total: len(lines), err: errors.Join(rejected...)}
+	}
+	return nil
+}
+
+func writeInfluxBatch(ctx context.Context, conn *influxConnection, lines []string, rejected *[]error) error {
+	err := conn.writeAPI.WriteRecord(ctx, lines...)
+	if err == nil || isInfluxUnavailable(err) {
+		return err
+	}
+
+	if len(lines) == 1 {
+		// Only the measurement is named; the point's values may be
+		// sensitive
+		measurement, _, _ := strings.Cut(lines[0], ",")
+		measurement, _, _ = strings.Cut(measurement, " ")
+		*rejected = append(*rejected, fmt.Errorf("%s point: %w", measurement, err))
+		return nil
+	}
+
+	half := len(lines) / 2
+	if err := writeInfluxBatch(ctx, conn, lines[:half], rejected); err != nil {
+		return err
+	}
+	return writeInfluxBatch(ctx, conn, lines[half:], rejected)
+}
+
+// isInfluxUnavailable reports whether a write failed because InfluxDB could
+// not be reached, could not authenticate us or was overloaded, rather than
+// because it rejected the data; only the former are worth spooling.
+func isInfluxUnavailable(err error) bool {
+	var rejected *influxRejectedError
+	if errors.As(err, &rejected) {
+		return false
+	}
+
+	var httpErr *http2.Error
+	if !errors.As(err, &httpErr) {
+		return true
+	}
+	switch httpErr.StatusCode {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity:
+		return false
+	default:
+		return true
+	}
+}
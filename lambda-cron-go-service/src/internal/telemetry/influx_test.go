@@ -0,0 +1,63 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+)
+
+func TestWriteInfluxLinesDropsOnlyRejectedPoints(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		written []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+		for _, line := range lines {
+			if strings.HasPrefix(line, "bad") {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"code":"invalid","message":"unable to parse points"}`))
+				return
+			}
+		}
+
+		mu.Lock()
+		written = append(written, lines...)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client := influxdb2.NewClient(server.URL, "token")
+	defer client.Close()
+	conn := &influxConnection{client: client, writeAPI: client.WriteAPIBlocking("org", "bucket")}
+
+	lines := []string{"good v=1 1", "bad v=2 2", "good v=3 3", "good v=4 4", "bad v=5 5"}
+	err := writeInfluxLines(context.Background(), conn, lines)
+
+	var rejected *influxRejectedError
+	if !errors.As(err, &rejected) {
+		t.Fatalf("writeInfluxLines() = %v, want an influxRejectedError", err)
+	}
+	if rejected.points != 2 || rejected.total != 5 {
+		t.Errorf("rejected %d of %d points, want 2 of 5", rejected.points, rejected.total)
+	}
+	if isInfluxUnavailable(err) {
+		t.Error("rejected points are treated as InfluxDB being unavailable")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"good v=1 1", "good v=3 3", "good v=4 4"}
+	if strings.Join(written, "\n") != strings.Join(want, "\n") {
+		t.Errorf("wrote %q, want %q", written, want)
+	}
+}
@@ -0,0 +1,64 @@
+package telemetry
+
+import (
+	"context"
+	"log/slog"
+	"os"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// logAttrsKey is the context key for the correlation fields added to every
+// line logged with that context.
+type logAttrsKey struct{}
+
+// setupLogging makes slog's default logger, and the standard log package
+// through it, write JSON lines at the level named by LOG_LEVEL (debug, info,
+// warn or error; info by default). Personal data is redacted from every
+// line.
+func setupLogging() {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(os.Getenv("LOG_LEVEL"))); err != nil {
+		level = slog.LevelInfo
+	}
+
+	handler := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level, ReplaceAttr: redactLogAttr})
+	slog.SetDefault(slog.New(contextHandler{handler}))
+}
+
+// WithLogAttrs returns a context whose log lines also carry attrs, such as
+// the SQS message ID or a work item's run ID, ID and type. The producer and
+// the worker use the same field names so Logs Insights queries can join the
+// two on run_id and work_id.
+func WithLogAttrs(ctx context.Context, attrs ...slog.Attr) context.Context {
+	existing, _ := ctx.Value(logAttrsKey{}).([]slog.Attr)
+	return context.WithValue(ctx, logAttrsKey{}, append(existing[:len(existing):len(existing)], attrs...))
+}
+
+// contextHandler adds the Lambda request ID, the context's correlation
+// fields and the current trace and span IDs to every record.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if lc, ok := lambdacontext.FromContext(ctx); ok {
+		record.AddAttrs(slog.String("aws_request_id", lc.AwsRequestID))
+	}
+	if attrs, ok := ctx.Value(logAttrsKey{}).([]slog.Attr); ok {
+		record.AddAttrs(attrs...)
+	}
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		record.AddAttrs(slog.String("trace_id", span.TraceID().String()), slog.String("span_id", span.SpanID().String()))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
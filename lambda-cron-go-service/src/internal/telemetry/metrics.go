@@ -0,0 +1,354 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tags are the indexed, low-cardinality labels of a metric or event, such
+// as a work type or status.
+type Tags map[string]string
+
+// Fields are the values recorded with an event.
+type Fields map[string]interface{}
+
+// MetricsSink is where a service records what it does. Counters, gauges
+// and timings are single numeric metrics; an event is a named record with
+// tags and any number of fields, which is how every InfluxDB measurement
+// the services have always written is expressed. Backends without an event
+// model count events instead.
+//
+// Sinks are safe for concurrent use and buffer freely; Flush must be called
+// before the invocation returns, and bounds its writes by ctx's deadline.
+type MetricsSink interface {
+	Counter(name string, value float64, tags Tags)
+	Gauge(name string, value float64, tags Tags)
+	Timing(name string, duration time.Duration, tags Tags)
+	Event(name string, tags Tags, fields Fields)
+	Flush(ctx context.Context) error
+}
+
+// Policies for metrics that could not be written, from METRICS_ERROR_POLICY.
+// Failed writes are always counted in the response; "warn" (the default)
+// also logs them and "fail" fails the run, or in the worker hands the
+// records whose metrics were lost back to SQS.
+const (
+	metricsErrorsIgnore = "ignore"
+	metricsErrorsWarn   = "warn"
+	metricsErrorsFail   = "fail"
+)
+
+// metricsSetupRetry is how long a degraded execution environment keeps
+// recording to the fallback sink before setting up its sinks again.
+const metricsSetupRetry = time.Minute
+
+var (
+	metricsSinkMu sync.Mutex
+	metricsSink   MetricsSink
+	// metricsDegraded is why some of the configured sinks could not be set
+	// up, or nil when they all were
+	metricsDegraded error
+	metricsBuiltAt  time.Time
+)
+
+// GetMetricsSink returns the metrics sink for this execution environment,
+// built on first use from METRICS_SINKS: a comma-separated list of
+// "influxdb" (the default), "emf", "prometheus" and "none".
+// Several sinks are fanned out to.
+//
+// Metrics are secondary to the work, so a sink that cannot be set up (say
+// the Prometheus registry cannot be reached) does not fail the invocation.
+// METRICS_FALLBACK_SINK ("none" by default) is used in its place, degraded
+// is reported as true along with an alarmable METRICS_DEGRADED log line, and
+// setup is tried again a minute later. InfluxDB is not contacted until the
+// first Flush; while its last Flush had to spool, degraded is reported the
+// same way. Only an unknown sink name is an error.
+func GetMetricsSink(ctx context.Context) (sink MetricsSink, degraded bool, err error) {
+	metricsSinkMu.Lock()
+	defer metricsSinkMu.Unlock()
+
+	if metricsSink == nil || (metricsDegraded != nil && time.Since(metricsBuiltAt) >= metricsSetupRetry) {
+		if err := buildMetricsSink(ctx); err != nil {
+			return nil, false, err
+		}
+	}
+
+	if metricsDegraded != nil {
+		slog.ErrorContext(ctx, "METRICS_DEGRADED: recording metrics to the fallback sink", "fallback_sink", metricsFallbackSink(), "error", metricsDegraded)
+	}
+	spooling := influxUnavailable()
+	if spooling != nil {
+		slog.ErrorContext(ctx, "METRICS_DEGRADED: InfluxDB is unavailable, spooling points for replay", "error", spooling)
+	}
+	return metricsSink, metricsDegraded != nil || spooling != nil, nil
+}
+
+// buildMetricsSink sets up the configured sinks. The caller must hold
+// metricsSinkMu.
+func buildMetricsSink(ctx context.Context) error {
+	names := os.Getenv("METRICS_SINKS")
+	if names == "" {
+		names = "influxdb"
+	}
+
+	if err := service.Schema.Validate(); err != nil {
+		return fmt.Errorf("invalid metrics schema: %w", err)
+	}
+
+	var sinks []MetricsSink
+	var failures []error
+	configured := map[string]bool{}
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if !knownMetricsSinks[name] {
+			return fmt.Errorf("unknown metrics sink %q", name)
+		}
+		configured[name] = true
+
+		sink, err := newMetricsSink(ctx, name)
+		if err != nil {
+			failures = append(failures, fmt.Errorf("failed to set up %s metrics: %w", name, err))
+			continue
+		}
+		if sink != nil {
+			sinks = append(sinks, sink)
+		}
+	}
+
+	// Fall back once, and not to a sink that is already recording
+	fallback := metricsFallbackSink()
+	if len(failures) > 0 && !configured[fallback] {
+		sink, err := newMetricsSink(ctx, fallback)
+		if err != nil {
+			failures = append(failures, fmt.Errorf("failed to set up %s fallback metrics: %w", fallback, err))
+		} else if sink != nil {
+			sinks = append(sinks, sink)
+		}
+	}
+
+	// Points are shaped to the metrics schema and personal data is
+	// redacted once, before they reach any backend
+	switch len(sinks) {
+	case 0:
+		metricsSink = noopSink{}
+	case 1:
+		metricsSink = newSchemaSink(redactingSink{sinks[0]})
+	default:
+		metricsSink = newSchemaSink(redactingSink{fanoutSink(sinks)})
+	}
+	metricsDegraded = errors.Join(failures...)
+	metricsBuiltAt = time.Now()
+
+	slog.InfoContext(ctx, "Recording metrics", "sinks", names)
+	return nil
+}
+
+// currentMetricsSink returns the sink GetMetricsSink last built, for
+// recording from inside a flush, or a sink that discards everything before
+// there is one.
+func currentMetricsSink() MetricsSink {
+	metricsSinkMu.Lock()
+	defer metricsSinkMu.Unlock()
+
+	if metricsSink == nil {
+		return noopSink{}
+	}
+	return metricsSink
+}
+
+var knownMetricsSinks = map[string]bool{
+	"influxdb": true, "emf": true, "prometheus": true, "none": true, "": true,
+}
+
+// metricsFallbackSink is the sink recorded to in place of sinks that could
+// not be set up, from METRICS_FALLBACK_SINK.
+func metricsFallbackSink() string {
+	if name := os.Getenv("METRICS_FALLBACK_SINK"); knownMetricsSinks[name] && name != "" {
+		return name
+	}
+	return "none"
+}
+
+func newMetricsSink(ctx context.Context, name string) (MetricsSink, error) {
+	switch name {
+	case "influxdb":
+		// Connecting waits for Flush, so points recorded while InfluxDB or
+		// its secret is unavailable, cold starts included, are spooled
+		return &influxSink{}, nil
+	case "emf":
+		return newEMFSink(os.Stdout), nil
+	case "prometheus":
+		return newPrometheusSink(ctx)
+	default:
+		return nil, nil
+	}
+}
+
+// FlushMetrics flushes the sink at the end of an invocation and applies the
+// metrics error policy. It returns the number of failed writes, and an
+// error only when the policy is "fail".
+func FlushMetrics(ctx context.Context, metrics MetricsSink) (int, error) {
+	err := metrics.Flush(ctx)
+	if err == nil {
+		return 0, nil
+	}
+
+	failed := countErrors(err)
+	switch metricsErrorPolicy() {
+	case metricsErrorsWarn:
+		slog.Warn("Metrics writes failed", "failed", failed, "error", err)
+	case metricsErrorsFail:
+		slog.Error("Metrics writes failed", "failed", failed, "error", err)
+		return failed, fmt.Errorf("%d metrics writes failed: %w", failed, err)
+	}
+
+	return failed, nil
+}
+
+func metricsErrorPolicy() string {
+	switch policy := os.Getenv("METRICS_ERROR_POLICY"); policy {
+	case metricsErrorsIgnore, metricsErrorsFail:
+		return policy
+	default:
+		return metricsErrorsWarn
+	}
+}
+
+// countErrors counts the individual errors in a possibly joined error.
+func countErrors(err error) int {
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return 1
+	}
+
+	count := 0
+	for _, inner := range joined.Unwrap() {
+		count += countErrors(inner)
+	}
+	return count
+}
+
+// fanoutSink records everything to several sinks.
+type fanoutSink []MetricsSink
+
+func (f fanoutSink) Counter(name string, value float64, tags Tags) {
+	for _, sink := range f {
+		sink.Counter(name, value, tags)
+	}
+}
+
+func (f fanoutSink) Gauge(name string, value float64, tags Tags) {
+	for _, sink := range f {
+		sink.Gauge(name, value, tags)
+	}
+}
+
+func (f fanoutSink) Timing(name string, duration time.Duration, tags Tags) {
+	for _, sink := range f {
+		sink.Timing(name, duration, tags)
+	}
+}
+
+func (f fanoutSink) Event(name string, tags Tags, fields Fields) {
+	for _, sink := range f {
+		sink.Event(name, tags, fields)
+	}
+}
+
+// Flush flushes every sink, even after one fails.
+func (f fanoutSink) Flush(ctx context.Context) error {
+	var errs []error
+	for _, sink := range f {
+		if err := sink.Flush(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// noopSink discards everything.
+type noopSink struct{}
+
+func (noopSink) Counter(string, float64, Tags)      {}
+func (noopSink) Gauge(string, float64, Tags)        {}
+func (noopSink) Timing(string, time.Duration, Tags) {}
+func (noopSink) Event(string, Tags, Fields)         {}
+func (noopSink) Flush(context.Context) error        { return nil }
+
+// metricRecord is one call recorded by the in-memory sink.
+type metricRecord struct {
+	Kind   string
+	Name   string
+	Value  float64
+	Tags   Tags
+	Fields Fields
+	Time   time.Time
+}
+
+// memorySink keeps everything in memory for tests. It is not offered
+// through METRICS_SINKS, as nothing could read it in a deployed function.
+type memorySink struct {
+	mu      sync.Mutex
+	records []metricRecord
+}
+
+func (m *memorySink) Counter(name string, value float64, tags Tags) {
+	m.add(metricRecord{Kind: "counter", Name: name, Value: value, Tags: tags})
+}
+
+func (m *memorySink) Gauge(name string, value float64, tags Tags) {
+	m.add(metricRecord{Kind: "gauge", Name: name, Value: value, Tags: tags})
+}
+
+func (m *memorySink) Timing(name string, duration time.Duration, tags Tags) {
+	m.add(metricRecord{Kind: "timing", Name: name, Value: float64(duration.Milliseconds()), Tags: tags})
+}
+
+func (m *memorySink) Event(name string, tags Tags, fields Fields) {
+	m.add(metricRecord{Kind: "event", Name: name, Tags: tags, Fields: fields})
+}
+
+func (m *memorySink) Flush(context.Context) error {
+	return nil
+}
+
+func (m *memorySink) add(record metricRecord) {
+	record.Time = time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.records = append(m.records, record)
+}
+
+// Records returns what has been recorded so far, optionally only the
+// records with the given name.
+func (m *memorySink) Records(name string) []metricRecord {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var records []metricRecord
+	for _, record := range m.records {
+		if name == "" || record.Name == name {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+// sortedTagKeys returns the keys of tags in a stable order.
+func sortedTagKeys(tags Tags) []string {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,112 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const defaultMetricsNamespace = "LambdaCronGo"
+
+// emfSink writes CloudWatch Embedded Metric Format records, one JSON line
+// per metric, which CloudWatch Logs turns into metrics in the
+// METRICS_NAMESPACE namespace without any API calls. Events become a count
+// metric named after the event, with their fields as properties.
+type emfSink struct {
+	mu        sync.Mutex
+	out       io.Writer
+	namespace string
+	// errs are the records that could not be written since the last Flush
+	errs []error
+}
+
+type emfMetric struct {
+	Name string `json:"Name"`
+	Unit string `json:"Unit"`
+}
+
+type emfDirective struct {
+	Namespace  string      `json:"Namespace"`
+	Dimensions [][]string  `json:"Dimensions"`
+	Metrics    []emfMetric `json:"Metrics"`
+}
+
+type emfMetadata struct {
+	Timestamp         int64          `json:"Timestamp"`
+	CloudWatchMetrics []emfDirective `json:"CloudWatchMetrics"`
+}
+
+func newEMFSink(out io.Writer) *emfSink {
+	namespace := os.Getenv("METRICS_NAMESPACE")
+	if namespace == "" {
+		namespace = defaultMetricsNamespace
+	}
+	return &emfSink{out: out, namespace: namespace}
+}
+
+func (s *emfSink) Counter(name string, value float64, tags Tags) {
+	s.write(name, value, "Count", tags, nil)
+}
+
+func (s *emfSink) Gauge(name string, value float64, tags Tags) {
+	s.write(name, value, "None", tags, nil)
+}
+
+func (s *emfSink) Timing(name string, duration time.Duration, tags Tags) {
+	s.write(name, float64(duration.Milliseconds()), "Milliseconds", tags, nil)
+}
+
+func (s *emfSink) Event(name string, tags Tags, fields Fields) {
+	s.write(name, 1, "Count", tags, fields)
+}
+
+// Flush reports the records that could not be written since the last
+// Flush; the records themselves are written as they happen.
+func (s *emfSink) Flush(context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := errors.Join(s.errs...)
+	s.errs = nil
+	return err
+}
+
+func (s *emfSink) write(name string, value float64, unit string, tags Tags, fields Fields) {
+	record := make(map[string]interface{}, len(fields)+len(tags)+2)
+	for key, fieldValue := range fields {
+		record[key] = fieldValue
+	}
+
+	dimensions := []string{}
+	for _, key := range sortedTagKeys(tags) {
+		record[key] = tags[key]
+		dimensions = append(dimensions, key)
+	}
+
+	record[name] = value
+	record["_aws"] = emfMetadata{
+		Timestamp: time.Now().UnixMilli(),
+		CloudWatchMetrics: []emfDirective{{
+			Namespace:  s.namespace,
+			Dimensions: [][]string{dimensions},
+			Metrics:    []emfMetric{{Name: name, Unit: unit}},
+		}},
+	}
+
+	line, err := json.Marshal(record)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err == nil {
+		_, err = s.out.Write(append(line, '\n'))
+	}
+	if err != nil {
+		s.errs = append(s.errs, fmt.Errorf("failed to write EMF record for %s: %w", name, err))
+	}
+}
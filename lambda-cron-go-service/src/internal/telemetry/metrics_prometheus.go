@@ -0,0 +1,248 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const prometheusPushTimeout = 10 * time.Second
+
+var (
+	invalidPrometheusName  = regexp.MustCompile(`[^a-zA-Z0-9_:]`)
+	invalidPrometheusLabel = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+)
+
+// prometheusSink pushes samples to a Prometheus remote-write endpoint
+// (PROMETHEUS_REMOTE_WRITE_URL) on every Flush. Requests are signed for
+// Amazon Managed Service for Prometheus when PROMETHEUS_REMOTE_WRITE_SIGV4
+// is "true".
+//
+// Counters are cumulative per execution environment, as Prometheus expects,
+// and every series carries an instance label naming the environment so
+// concurrent environments do not overwrite each other's totals. Timings
+// become _seconds_sum and _seconds_count counters, and events are counted
+// as <event>_total.
+type prometheusSink struct {
+	mu       sync.Mutex
+	url      string
+	instance string
+	series   map[string]*prometheusSeries
+	pending  map[string]bool
+
+	client *http.Client
+	signer *v4.Signer
+	awsCfg aws.Config
+}
+
+type prometheusSeries struct {
+	labels [][2]string
+	value  float64
+}
+
+func newPrometheusSink(ctx context.Context) (*prometheusSink, error) {
+	url := os.Getenv("PROMETHEUS_REMOTE_WRITE_URL")
+	if url == "" {
+		return nil, fmt.Errorf("PROMETHEUS_REMOTE_WRITE_URL environment variable is not set")
+	}
+
+	instance := os.Getenv("AWS_LAMBDA_LOG_STREAM_NAME")
+	if instance == "" {
+		instance, _ = os.Hostname()
+	}
+
+	sink := &prometheusSink{
+		url:      url,
+		instance: instance,
+		series:   map[string]*prometheusSeries{},
+		pending:  map[string]bool{},
+		client:   &http.Client{Timeout: prometheusPushTimeout},
+	}
+
+	if os.Getenv("PROMETHEUS_REMOTE_WRITE_SIGV4") == "true" {
+		cfg, err := GetAWSConfig(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load AWS config: %w", err)
+		}
+		sink.awsCfg = cfg
+		sink.signer = v4.NewSigner()
+	}
+
+	return sink, nil
+}
+
+func (s *prometheusSink) Counter(name string, value float64, tags Tags) {
+	s.add(name+"_total", value, tags)
+}
+
+func (s *prometheusSink) Gauge(name string, value float64, tags Tags) {
+	s.set(name, value, tags)
+}
+
+func (s *prometheusSink) Timing(name string, duration time.Duration, tags Tags) {
+	s.add(name+"_seconds_sum", duration.Seconds(), tags)
+	s.add(name+"_seconds_count", 1, tags)
+}
+
+func (s *prometheusSink) Event(name string, tags Tags, fields Fields) {
+	s.add(name+"_total", 1, tags)
+}
+
+func (s *prometheusSink) add(name string, delta float64, tags Tags) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	series := s.seriesFor(name, tags)
+	series.value += delta
+}
+
+func (s *prometheusSink) set(name string, value float64, tags Tags) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	series := s.seriesFor(name, tags)
+	series.value = value
+}
+
+// seriesFor returns the series for a metric name and tags, marking it to be
+// sent on the next Flush. The caller must hold s.mu.
+func (s *prometheusSink) seriesFor(name string, tags Tags) *prometheusSeries {
+	labels := [][2]string{
+		{"__name__", invalidPrometheusName.ReplaceAllString(name, "_")},
+		{"instance", s.instance},
+		{"job", service.Name},
+	}
+	for key, value := range tags {
+		labels = append(labels, [2]string{invalidPrometheusLabel.ReplaceAllString(key, "_"), value})
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i][0] < labels[j][0] })
+
+	var key strings.Builder
+	for _, label := range labels {
+		key.WriteString(label[0])
+		key.WriteByte('=')
+		key.WriteString(label[1])
+		key.WriteByte(0)
+	}
+
+	series, ok := s.series[key.String()]
+	if !ok {
+		series = &prometheusSeries{labels: labels}
+		s.series[key.String()] = series
+	}
+	s.pending[key.String()] = true
+
+	return series
+}
+
+// Flush pushes every series changed since the last successful Flush.
+func (s *prometheusSink) Flush(ctx context.Context) error {
+	s.mu.Lock()
+	if len(s.pending) == 0 {
+		s.mu.Unlock()
+		return nil
+	}
+
+	timestamp := time.Now().UnixMilli()
+	var request []byte
+	for key := range s.pending {
+		request = protowire.AppendTag(request, 1, protowire.BytesType)
+		request = protowire.AppendBytes(request, encodeTimeSeries(s.series[key], timestamp))
+	}
+	pending := s.pending
+	s.pending = map[string]bool{}
+	s.mu.Unlock()
+
+	if err := s.push(ctx, snappy.Encode(nil, request)); err != nil {
+		// Counters are cumulative, so resending the series next time loses
+		// nothing but the gauges' intermediate values
+		s.mu.Lock()
+		for key := range pending {
+			s.pending[key] = true
+		}
+		s.mu.Unlock()
+		return fmt.Errorf("failed to push metrics to Prometheus: %w", err)
+	}
+
+	return nil
+}
+
+func (s *prometheusSink) push(ctx context.Context, body []byte) error {
+	ctx, cancel := writeContext(ctx, prometheusPushTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	if s.signer != nil {
+		credentials, err := s.awsCfg.Credentials.Retrieve(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to retrieve AWS credentials: %w", err)
+		}
+		hash := sha256.Sum256(body)
+		if err := s.signer.SignHTTP(ctx, credentials, req, hex.EncodeToString(hash[:]), "aps", s.awsCfg.Region, time.Now()); err != nil {
+			return fmt.Errorf("failed to sign request: %w", err)
+		}
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("remote write returned %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+
+	return nil
+}
+
+// encodeTimeSeries encodes one prometheus.TimeSeries message holding a
+// single sample.
+func encodeTimeSeries(series *prometheusSeries, timestamp int64) []byte {
+	var encoded []byte
+	for _, label := range series.labels {
+		var labelMessage []byte
+		labelMessage = protowire.AppendTag(labelMessage, 1, protowire.BytesType)
+		labelMessage = protowire.AppendString(labelMessage, label[0])
+		labelMessage = protowire.AppendTag(labelMessage, 2, protowire.BytesType)
+		labelMessage = protowire.AppendString(labelMessage, label[1])
+
+		encoded = protowire.AppendTag(encoded, 1, protowire.BytesType)
+		encoded = protowire.AppendBytes(encoded, labelMessage)
+	}
+
+	var sample []byte
+	sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+	sample = protowire.AppendFixed64(sample, math.Float64bits(series.value))
+	sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+	sample = protowire.AppendVarint(sample, uint64(timestamp))
+
+	encoded = protowire.AppendTag(encoded, 2, protowire.BytesType)
+	encoded = protowire.AppendBytes(encoded, sample)
+
+	return encoded
+}
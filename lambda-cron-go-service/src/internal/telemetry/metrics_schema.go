@@ -0,0 +1,212 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MeasurementSchema declares what a measurement may carry. Tags become
+// InfluxDB series, CloudWatch dimensions and Prometheus labels, so only
+// low-cardinality values such as a work type or status belong there; IDs,
+// counts and durations are fields.
+type MeasurementSchema struct {
+	Tags   []string
+	Fields []string
+}
+
+// Schema is every measurement a service writes, by name. A tag declared as
+// a field, such as message_id, is written as a field instead.
+type Schema map[string]MeasurementSchema
+
+// defaultMetricTagKeys are the tags added to every point by
+// defaultMetricTags; measurements may not declare them.
+var defaultMetricTagKeys = []string{"environment", "function_name", "function_version"}
+
+// defaultMetricTags are added to every point: the environment, the
+// function name, which is the same in every environment, and the deployed
+// Lambda version.
+func defaultMetricTags() Tags {
+	tags := Tags{"function_name": service.Name}
+	if environment := os.Getenv("ENVIRONMENT"); environment != "" {
+		tags["environment"] = environment
+	}
+	if version := os.Getenv("AWS_LAMBDA_FUNCTION_VERSION"); version != "" {
+		tags["function_version"] = version
+	}
+	return tags
+}
+
+// Validate checks the schema itself: no key may be both a tag and a field,
+// and default tags may not be redeclared.
+func (s Schema) Validate() error {
+	names := make([]string, 0, len(s))
+	for name := range s {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		tags := map[string]bool{}
+		for _, tag := range s[name].Tags {
+			if slices.Contains(defaultMetricTagKeys, tag) {
+				errs = append(errs, fmt.Errorf("measurement %s redeclares default tag %s", name, tag))
+			}
+			tags[tag] = true
+		}
+		for _, field := range s[name].Fields {
+			if tags[field] {
+				errs = append(errs, fmt.Errorf("measurement %s declares %s as both a tag and a field", name, field))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// buildPoint shapes a point to its measurement's schema and adds the
+// default tags. Tags declared as fields are moved to the fields. Anything
+// undeclared is a violation: an undeclared tag is moved to the fields too,
+// so it cannot add series, and an undeclared field is kept. A measurement
+// missing from the schema keeps only the default tags.
+func (s Schema) buildPoint(defaults Tags, name string, tags Tags, fields Fields) (Tags, Fields, []error) {
+	schema, known := s[name]
+
+	var violations []error
+	if !known {
+		violations = append(violations, fmt.Errorf("measurement %s is not in the metrics schema", name))
+	}
+
+	pointTags := make(Tags, len(defaults)+len(tags))
+	pointFields := make(Fields, len(fields)+len(tags))
+	for key, value := range fields {
+		if known && !slices.Contains(schema.Fields, key) {
+			violations = append(violations, fmt.Errorf("measurement %s has undeclared field %s", name, key))
+		}
+		pointFields[key] = value
+	}
+	for _, key := range sortedTagKeys(tags) {
+		if slices.Contains(schema.Tags, key) {
+			pointTags[key] = tags[key]
+			continue
+		}
+		if known && !slices.Contains(schema.Fields, key) {
+			violations = append(violations, fmt.Errorf("measurement %s has undeclared tag %s", name, key))
+		}
+		if _, ok := pointFields[key]; !ok {
+			pointFields[key] = tags[key]
+		}
+	}
+	for key, value := range defaults {
+		pointTags[key] = value
+	}
+
+	return pointTags, pointFields, violations
+}
+
+// Check reports how a point would break the schema, so a service's tests
+// can check the points its code writes.
+func (s Schema) Check(name string, tags Tags, fields Fields) error {
+	_, _, violations := s.buildPoint(defaultMetricTags(), name, tags, fields)
+	return errors.Join(violations...)
+}
+
+// metricsSchemaStrict is the METRICS_SCHEMA_MODE that drops violating
+// points and reports them from Flush, like failed writes, so tests and
+// local runs with METRICS_ERROR_POLICY=fail reject them. Otherwise, and in
+// "enforce" mode, points are shaped by buildPoint and each kind of violation
+// is logged once.
+const metricsSchemaStrict = "strict"
+
+// schemaSink applies the metrics schema before points reach the sinks.
+// Counters, gauges and timings have no fields, so tags moved to the fields
+// are dropped from them.
+type schemaSink struct {
+	MetricsSink
+	schema   Schema
+	defaults Tags
+	strict   bool
+
+	mu     sync.Mutex
+	errs   []error
+	logged map[string]bool
+}
+
+func newSchemaSink(sink MetricsSink) *schemaSink {
+	return &schemaSink{
+		MetricsSink: sink,
+		schema:      service.Schema,
+		defaults:    defaultMetricTags(),
+		strict:      metricsSchemaIsStrict(),
+		logged:      map[string]bool{},
+	}
+}
+
+func metricsSchemaIsStrict() bool {
+	return os.Getenv("METRICS_SCHEMA_MODE") == metricsSchemaStrict
+}
+
+func (s *schemaSink) Counter(name string, value float64, tags Tags) {
+	if tags, _, ok := s.point(name, tags, nil); ok {
+		s.MetricsSink.Counter(name, value, tags)
+	}
+}
+
+func (s *schemaSink) Gauge(name string, value float64, tags Tags) {
+	if tags, _, ok := s.point(name, tags, nil); ok {
+		s.MetricsSink.Gauge(name, value, tags)
+	}
+}
+
+func (s *schemaSink) Timing(name string, duration time.Duration, tags Tags) {
+	if tags, _, ok := s.point(name, tags, nil); ok {
+		s.MetricsSink.Timing(name, duration, tags)
+	}
+}
+
+func (s *schemaSink) Event(name string, tags Tags, fields Fields) {
+	if tags, fields, ok := s.point(name, tags, fields); ok {
+		s.MetricsSink.Event(name, tags, fields)
+	}
+}
+
+// Flush flushes the sinks and, in strict mode, reports the points dropped
+// since the last Flush.
+func (s *schemaSink) Flush(ctx context.Context) error {
+	s.mu.Lock()
+	errs := s.errs
+	s.errs = nil
+	s.mu.Unlock()
+
+	return errors.Join(append(errs, s.MetricsSink.Flush(ctx))...)
+}
+
+// point builds a point and reports whether it should be written.
+func (s *schemaSink) point(name string, tags Tags, fields Fields) (Tags, Fields, bool) {
+	tags, fields, violations := s.schema.buildPoint(s.defaults, name, tags, fields)
+	if len(violations) == 0 {
+		return tags, fields, true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.strict {
+		s.errs = append(s.errs, fmt.Errorf("dropped %s point: %w", name, errors.Join(violations...)))
+		return nil, nil, false
+	}
+
+	for _, violation := range violations {
+		if !s.logged[violation.Error()] {
+			s.logged[violation.Error()] = true
+			slog.Warn("Metrics schema violation", "measurement", name, "error", violation)
+		}
+	}
+	return tags, fields, true
+}
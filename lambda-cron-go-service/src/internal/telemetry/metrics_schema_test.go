@@ -0,0 +1,192 @@
+package telemetry
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testSchema = Schema{
+	"work_item_processing": {
+		Tags:   []string{"work_type", "status"},
+		Fields: []string{"work_id", "message_id", "duration_ms"},
+	},
+}
+
+func TestSchemaValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema Schema
+		want   string
+	}{
+		{name: "valid", schema: testSchema},
+		{
+			name:   "default tag",
+			schema: Schema{"m": {Tags: []string{"environment"}}},
+			want:   "measurement m redeclares default tag environment",
+		},
+		{
+			name:   "tag and field",
+			schema: Schema{"m": {Tags: []string{"status"}, Fields: []string{"status"}}},
+			want:   "measurement m declares status as both a tag and a field",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.schema.Validate()
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.want {
+				t.Fatalf("Validate() = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildPoint(t *testing.T) {
+	defaults := Tags{"function_name": "test"}
+
+	tests := []struct {
+		name        string
+		measurement string
+		tags        Tags
+		fields      Fields
+		wantTags    Tags
+		wantFields  Fields
+		violations  []string
+	}{
+		{
+			name:        "declared",
+			measurement: "work_item_processing",
+			tags:        Tags{"work_type": "email_notification", "status": "success"},
+			fields:      Fields{"work_id": 1, "duration_ms": 20},
+			wantTags:    Tags{"function_name": "test", "work_type": "email_notification", "status": "success"},
+			wantFields:  Fields{"work_id": 1, "duration_ms": 20},
+		},
+		{
+			name:        "tag declared as a field",
+			measurement: "work_item_processing",
+			tags:        Tags{"status": "success", "message_id": "m-1"},
+			fields:      Fields{"work_id": 1},
+			wantTags:    Tags{"function_name": "test", "status": "success"},
+			wantFields:  Fields{"work_id": 1, "message_id": "m-1"},
+		},
+		{
+			name:        "undeclared tag",
+			measurement: "work_item_processing",
+			tags:        Tags{"status": "success", "user": "u-1"},
+			wantTags:    Tags{"function_name": "test", "status": "success"},
+			wantFields:  Fields{"user": "u-1"},
+			violations:  []string{"measurement work_item_processing has undeclared tag user"},
+		},
+		{
+			name:        "undeclared field",
+			measurement: "work_item_processing",
+			fields:      Fields{"work_id": 1, "attempt": 2},
+			wantTags:    Tags{"function_name": "test"},
+			wantFields:  Fields{"work_id": 1, "attempt": 2},
+			violations:  []string{"measurement work_item_processing has undeclared field attempt"},
+		},
+		{
+			name:        "unknown measurement",
+			measurement: "work_item_retry",
+			tags:        Tags{"status": "retry"},
+			wantTags:    Tags{"function_name": "test"},
+			wantFields:  Fields{"status": "retry"},
+			violations:  []string{"measurement work_item_retry is not in the metrics schema"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tags, fields, violations := testSchema.buildPoint(defaults, tt.measurement, tt.tags, tt.fields)
+			if !reflect.DeepEqual(tags, tt.wantTags) {
+				t.Errorf("tags = %v, want %v", tags, tt.wantTags)
+			}
+			if !reflect.DeepEqual(fields, tt.wantFields) {
+				t.Errorf("fields = %v, want %v", fields, tt.wantFields)
+			}
+
+			var got []string
+			for _, violation := range violations {
+				got = append(got, violation.Error())
+			}
+			if !reflect.DeepEqual(got, tt.violations) {
+				t.Errorf("violations = %q, want %q", got, tt.violations)
+			}
+		})
+	}
+}
+
+func TestSchemaSinkStrict(t *testing.T) {
+	t.Setenv("METRICS_SCHEMA_MODE", "strict")
+
+	previous := service
+	service = Service{Name: "test", Schema: testSchema}
+	t.Cleanup(func() { service = previous })
+
+	memory := &memorySink{}
+	sink := newSchemaSink(memory)
+	if !sink.strict {
+		t.Fatal("schema sink is not strict with METRICS_SCHEMA_MODE=strict")
+	}
+
+	sink.Event("work_item_processing", Tags{"status": "success"}, Fields{"work_id": 1})
+	sink.Event("work_item_processing", Tags{"status": "success", "user": "u-1"}, Fields{"work_id": 2})
+	sink.Event("work_item_processing", Tags{"status": "success"}, Fields{"work_id": 3, "attempt": 2})
+
+	err := sink.Flush(context.Background())
+	if err == nil {
+		t.Fatal("Flush() = nil, want the dropped points reported")
+	}
+	for _, want := range []string{"has undeclared tag user", "has undeclared field attempt"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Flush() = %v, want it to report %q", err, want)
+		}
+	}
+	if got := countErrors(err); got != 2 {
+		t.Errorf("Flush() reported %d errors, want 2", got)
+	}
+
+	records := memory.Records("work_item_processing")
+	if len(records) != 1 || records[0].Fields["work_id"] != 1 {
+		t.Fatalf("recorded %v, want only work item 1", records)
+	}
+
+	if err := sink.Flush(context.Background()); err != nil {
+		t.Errorf("second Flush() = %v, want nil", err)
+	}
+}
+
+func TestSchemaSinkEnforce(t *testing.T) {
+	t.Setenv("METRICS_SCHEMA_MODE", "enforce")
+
+	previous := service
+	service = Service{Name: "test", Schema: testSchema}
+	t.Cleanup(func() { service = previous })
+
+	memory := &memorySink{}
+	sink := newSchemaSink(memory)
+
+	sink.Event("work_item_processing", Tags{"status": "success", "user": "u-1"}, Fields{"work_id": 1})
+	if err := sink.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush() = %v, want nil", err)
+	}
+
+	records := memory.Records("work_item_processing")
+	if len(records) != 1 {
+		t.Fatalf("recorded %d points, want 1", len(records))
+	}
+	if _, ok := records[0].Tags["user"]; ok {
+		t.Errorf("undeclared tag user was written as a tag: %v", records[0].Tags)
+	}
+	if records[0].Fields["user"] != "u-1" {
+		t.Errorf("undeclared tag user was not moved to the fields: %v", records[0].Fields)
+	}
+}
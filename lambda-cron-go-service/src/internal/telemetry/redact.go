@@ -0,0 +1,253 @@
+package telemetry
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Redaction modes. Hashed values are a keyed HMAC of the normalised value,
+// so an email or user ID hashes the same in every log line and metric and
+// can still be correlated; masked values keep only enough to eyeball.
+const (
+	redactHash = "hash"
+	redactMask = "mask"
+)
+
+// defaultSensitiveKeys are redacted wherever they appear as a log attribute,
+// payload key, metric tag or metric field. Keys match regardless of case,
+// underscores and dashes, so "userId" also covers "user_id". Redacted
+// values are strings, so metrics never write user IDs to the numeric user_id
+// field; they write user_ref, which is always redacted.
+var defaultSensitiveKeys = []string{"email", "notifyEmail", "recipient", "phone", "userId", "userRef"}
+
+// redactor keeps personal data out of logs and metrics. Values are found by
+// key, from defaultSensitiveKeys and REDACT_KEYS, or by a `redact:"hash"` or
+// `redact:"mask"` tag on a field of one of the service's own types.
+type redactor struct {
+	modes   map[string]string
+	hashKey []byte
+}
+
+var (
+	redactorOnce   sync.Once
+	activeRedactor *redactor
+)
+
+// getRedactor returns the redactor configured by REDACT_KEYS, a
+// comma-separated list of extra keys each optionally suffixed with ":hash"
+// or ":mask"; REDACTION_MODE, the mode for keys without one ("hash" by
+// default); and REDACTION_HASH_KEY, the HMAC key. Without a hash key values
+// are plain SHA-256 hashes, which are stable but can be guessed for
+// low-entropy values such as user IDs.
+func getRedactor() *redactor {
+	redactorOnce.Do(func() {
+		defaultMode := redactHash
+		if os.Getenv("REDACTION_MODE") == redactMask {
+			defaultMode = redactMask
+		}
+
+		r := &redactor{modes: map[string]string{}, hashKey: []byte(os.Getenv("REDACTION_HASH_KEY"))}
+		for _, key := range defaultSensitiveKeys {
+			r.modes[normaliseRedactKey(key)] = defaultMode
+		}
+		for _, entry := range strings.Split(os.Getenv("REDACT_KEYS"), ",") {
+			key, mode, _ := strings.Cut(strings.TrimSpace(entry), ":")
+			if key == "" {
+				continue
+			}
+			if mode != redactHash && mode != redactMask {
+				mode = defaultMode
+			}
+			r.modes[normaliseRedactKey(key)] = mode
+		}
+
+		activeRedactor = r
+	})
+
+	return activeRedactor
+}
+
+func normaliseRedactKey(key string) string {
+	return strings.NewReplacer("_", "", "-", "").Replace(strings.ToLower(key))
+}
+
+// value returns v, found under key, with anything sensitive redacted. Maps
+// and slices are walked; so are the service's own structs, which are turned
+// into maps keyed by their JSON names.
+func (r *redactor) value(key string, v interface{}) interface{} {
+	if mode := r.modes[normaliseRedactKey(key)]; mode != "" && v != nil {
+		return r.redact(mode, v)
+	}
+
+	switch typed := v.(type) {
+	case error, slog.LogValuer:
+		return v
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(typed))
+		for k, inner := range typed {
+			redacted[k] = r.value(k, inner)
+		}
+		return redacted
+	case Fields:
+		return Fields(r.value("", map[string]interface{}(typed)).(map[string]interface{}))
+	case []interface{}:
+		redacted := make([]interface{}, len(typed))
+		for i, inner := range typed {
+			redacted[i] = r.value("", inner)
+		}
+		return redacted
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Pointer && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() == reflect.Struct && rv.Type().PkgPath() == "main" {
+		return r.structValue(rv)
+	}
+	return v
+}
+
+func (r *redactor) structValue(rv reflect.Value) map[string]interface{} {
+	redacted := map[string]interface{}{}
+	for i := 0; i < rv.NumField(); i++ {
+		field := rv.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		value := rv.Field(i).Interface()
+		switch mode := field.Tag.Get("redact"); mode {
+		case redactHash, redactMask:
+			redacted[name] = r.redact(mode, value)
+		default:
+			redacted[name] = r.value(name, value)
+		}
+	}
+	return redacted
+}
+
+// redact hashes or masks a single value.
+func (r *redactor) redact(mode string, v interface{}) string {
+	if pointer := reflect.ValueOf(v); pointer.Kind() == reflect.Pointer {
+		if pointer.IsNil() {
+			return ""
+		}
+		v = pointer.Elem().Interface()
+	}
+	plain := strings.TrimSpace(fmt.Sprint(v))
+	if number, ok := v.(float64); ok {
+		// IDs decoded from JSON payloads are floats; format them like ints
+		// so they hash the same either way
+		plain = strconv.FormatFloat(number, 'f', -1, 64)
+	}
+	if plain == "" {
+		return ""
+	}
+
+	if mode == redactMask {
+		if local, domain, ok := strings.Cut(plain, "@"); ok && local != "" {
+			_, size := utf8.DecodeRuneInString(local)
+			return local[:size] + "***@" + domain
+		}
+		return "***"
+	}
+
+	var sum []byte
+	normalised := strings.ToLower(plain)
+	if len(r.hashKey) > 0 {
+		mac := hmac.New(sha256.New, r.hashKey)
+		mac.Write([]byte(normalised))
+		sum = mac.Sum(nil)
+	} else {
+		hash := sha256.Sum256([]byte(normalised))
+		sum = hash[:]
+	}
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
+
+// redactLogAttr is the slog ReplaceAttr hook that redacts every log line.
+func redactLogAttr(groups []string, attr slog.Attr) slog.Attr {
+	if len(groups) == 0 && (attr.Key == slog.TimeKey || attr.Key == slog.LevelKey || attr.Key == slog.MessageKey) {
+		return attr
+	}
+
+	value := attr.Value.Resolve()
+	switch value.Kind() {
+	case slog.KindGroup:
+		// Handlers do not call ReplaceAttr on the contents of a group that
+		// a LogValuer resolved to, so redact them here
+		inner := value.Group()
+		redacted := make([]slog.Attr, len(inner))
+		for i, a := range inner {
+			redacted[i] = redactLogAttr(append(groups[:len(groups):len(groups)], attr.Key), a)
+		}
+		return slog.Attr{Key: attr.Key, Value: slog.GroupValue(redacted...)}
+	case slog.KindAny:
+		return slog.Any(attr.Key, getRedactor().value(attr.Key, value.Any()))
+	default:
+		if mode := getRedactor().modes[normaliseRedactKey(attr.Key)]; mode != "" {
+			return slog.String(attr.Key, getRedactor().redact(mode, value.Any()))
+		}
+		return attr
+	}
+}
+
+// redactingSink redacts tags and fields before they reach the sink.
+type redactingSink struct {
+	MetricsSink
+}
+
+func (s redactingSink) Counter(name string, value float64, tags Tags) {
+	s.MetricsSink.Counter(name, value, redactTags(tags))
+}
+
+func (s redactingSink) Gauge(name string, value float64, tags Tags) {
+	s.MetricsSink.Gauge(name, value, redactTags(tags))
+}
+
+func (s redactingSink) Timing(name string, duration time.Duration, tags Tags) {
+	s.MetricsSink.Timing(name, duration, redactTags(tags))
+}
+
+func (s redactingSink) Event(name string, tags Tags, fields Fields) {
+	var redacted Fields
+	if fields != nil {
+		redacted = getRedactor().value("", fields).(Fields)
+	}
+	s.MetricsSink.Event(name, redactTags(tags), redacted)
+}
+
+func redactTags(tags Tags) Tags {
+	if tags == nil {
+		return nil
+	}
+
+	r := getRedactor()
+	redacted := make(Tags, len(tags))
+	for key, value := range tags {
+		if mode := r.modes[normaliseRedactKey(key)]; mode != "" {
+			value = r.redact(mode, value)
+		}
+		redacted[key] = value
+	}
+	return redacted
+}
@@ -0,0 +1,33 @@
+package telemetry
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+type recipientValue struct{ email string }
+
+func (v recipientValue) LogValue() slog.Value {
+	return slog.GroupValue(slog.String("email", v.email))
+}
+
+func TestRedactLogAttrRedactsGroups(t *testing.T) {
+	var out bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&out, &slog.HandlerOptions{ReplaceAttr: redactLogAttr}))
+
+	logger.Info("sent", "recipient_value", recipientValue{email: "ada@example.com"}, slog.Group("user", "email", "ada@example.com"))
+
+	if strings.Contains(out.String(), "ada@example.com") {
+		t.Fatalf("log line %s contains the email address", out.String())
+	}
+}
+
+func TestRedactMaskKeepsWholeFirstRune(t *testing.T) {
+	r := &redactor{modes: map[string]string{}}
+
+	if got := r.redact(redactMask, "émile@example.com"); got != "é***@example.com" {
+		t.Fatalf("redact(mask) = %q, want %q", got, "é***@example.com")
+	}
+}
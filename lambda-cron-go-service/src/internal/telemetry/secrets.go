@@ -0,0 +1,67 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+
+	"lambda-cron-go-service/internal/env"
+)
+
+const defaultSecretCacheTTL = 5 * time.Minute
+
+type cachedSecret struct {
+	value     string
+	fetchedAt time.Time
+}
+
+var (
+	secretsMu sync.Mutex
+	secrets   = map[string]cachedSecret{}
+)
+
+// GetSecret returns the current value of a Secrets Manager secret, cached
+// for SECRET_CACHE_TTL_SECONDS so warm invocations skip the API call.
+func GetSecret(ctx context.Context, secretArn string) (string, error) {
+	if secretArn == "" {
+		return "", fmt.Errorf("no secret ARN configured")
+	}
+
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+
+	ttl := time.Duration(env.Int("SECRET_CACHE_TTL_SECONDS", int(defaultSecretCacheTTL.Seconds()))) * time.Second
+	if cached, ok := secrets[secretArn]; ok && time.Since(cached.fetchedAt) < ttl {
+		return cached.value, nil
+	}
+
+	cfg, err := GetAWSConfig(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	result, err := secretsmanager.NewFromConfig(cfg).GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId:     aws.String(secretArn),
+		VersionStage: aws.String("AWSCURRENT"),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	value := aws.ToString(result.SecretString)
+	secrets[secretArn] = cachedSecret{value: value, fetchedAt: time.Now()}
+	return value, nil
+}
+
+// InvalidateSecret drops a cached secret so the next GetSecret reads it
+// again, for example after the credentials in it were rejected.
+func InvalidateSecret(secretArn string) {
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+
+	delete(secrets, secretArn)
+}
@@ -0,0 +1,374 @@
+package telemetry
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"lambda-cron-go-service/internal/env"
+)
+
+const (
+	defaultSpoolDir = "/tmp/metrics-spool"
+	spoolPrefix     = "metrics-spool/"
+	spoolSuffix     = ".lp"
+	// rejectedSpoolDir holds, under the spool, batches InfluxDB refused, so
+	// they are kept for inspection without holding up the rest
+	rejectedSpoolDir = "rejected/"
+	// defaultSpoolReplayBatches bounds how many spooled batches one flush
+	// replays, so catching up after a long outage is spread over several
+	// invocations
+	defaultSpoolReplayBatches = 5
+	// defaultSpoolMaxMB bounds a local spool, rejected batches included, so
+	// a long outage cannot fill the environment's /tmp
+	defaultSpoolMaxMB = 128
+)
+
+// metricsSpool keeps batches of line protocol that InfluxDB could not take.
+// Batch names sort oldest first, and List leaves out rejected batches.
+//
+// Replay is at least once: a batch can be sent again after a failed
+// delete, by two environments sharing the S3 spool, or, for the points
+// InfluxDB took, when part of it is rejected. That is only correct because
+// InfluxDB overwrites a point with the same measurement, tag set and
+// timestamp instead of adding another, and lines keep the timestamps they
+// were recorded with. Points are not given idempotency keys, so a sink that
+// appended them would double count.
+type metricsSpool interface {
+	Save(ctx context.Context, lines []string) (string, error)
+	List(ctx context.Context, limit int) ([]string, error)
+	Load(ctx context.Context, name string) ([]string, error)
+	Remove(ctx context.Context, name string) error
+	Reject(ctx context.Context, name string) (string, error)
+}
+
+var (
+	spoolOnce   sync.Once
+	activeSpool metricsSpool
+)
+
+// getMetricsSpool returns the spool for this execution environment: the S3
+// bucket named by METRICS_SPOOL_BUCKET, which survives the environment and
+// is shared by every function, or else METRICS_SPOOL_DIR (/tmp/metrics-spool
+// by default), which only the next warm invocation of this environment
+// will see.
+func getMetricsSpool(ctx context.Context) metricsSpool {
+	spoolOnce.Do(func() {
+		if bucket := os.Getenv("METRICS_SPOOL_BUCKET"); bucket != "" {
+			cfg, err := GetAWSConfig(ctx)
+			if err == nil {
+				activeSpool = &s3Spool{client: s3.NewFromConfig(cfg), bucket: bucket}
+				return
+			}
+			slog.WarnContext(ctx, "Failed to load AWS config for the S3 metrics spool, spooling to local disk", "error", err)
+		}
+
+		dir := os.Getenv("METRICS_SPOOL_DIR")
+		if dir == "" {
+			dir = defaultSpoolDir
+		}
+		activeSpool = &dirSpool{dir: dir, maxBytes: int64(env.Int("METRICS_SPOOL_MAX_MB", defaultSpoolMaxMB)) << 20}
+	})
+
+	return activeSpool
+}
+
+// spoolBatchName names a new batch so that names sort by creation time.
+func spoolBatchName() string {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return fmt.Sprintf("%020d-%s%s", time.Now().UnixNano(), hex.EncodeToString(suffix), spoolSuffix)
+}
+
+// replaySpooledMetrics re-sends spooled batches, oldest first, until
+// InfluxDB is unavailable again or METRICS_SPOOL_REPLAY_BATCHES have been
+// taken off the spool, and returns how many were. A batch InfluxDB rejects
+// is moved to rejected/ and the rest carry on. A batch replayed twice does
+// not double count; see metricsSpool.
+func replaySpooledMetrics(ctx context.Context, send func(ctx context.Context, lines []string) error) (int, error) {
+	spool := getMetricsSpool(ctx)
+
+	names, err := spool.List(ctx, env.Int("METRICS_SPOOL_REPLAY_BATCHES", defaultSpoolReplayBatches))
+	if err != nil {
+		return 0, fmt.Errorf("failed to list spooled metrics: %w", err)
+	}
+
+	drained := 0
+	for _, name := range names {
+		lines, err := spool.Load(ctx, name)
+		if err != nil {
+			return drained, fmt.Errorf("failed to load spooled metrics %s: %w", name, err)
+		}
+
+		if err := send(ctx, lines); err != nil {
+			if isInfluxUnavailable(err) {
+				return drained, fmt.Errorf("failed to replay spooled metrics %s: %w", name, err)
+			}
+
+			location, rejectErr := spool.Reject(ctx, name)
+			if rejectErr != nil {
+				return drained, fmt.Errorf("failed to set aside rejected metrics %s: %w (InfluxDB rejected them: %v)", name, rejectErr, err)
+			}
+			slog.ErrorContext(ctx, "InfluxDB rejected spooled points, set them aside", "points", len(lines), "batch", name, "location", location, "error", err)
+			drained++
+			continue
+		}
+
+		if err := spool.Remove(ctx, name); err != nil {
+			return drained, fmt.Errorf("failed to remove replayed metrics %s: %w", name, err)
+		}
+
+		slog.InfoContext(ctx, "Replayed spooled points", "points", len(lines), "batch", name)
+		drained++
+	}
+
+	return drained, nil
+}
+
+// RunMetricsReplay replays the whole spool once and exits, for catching up
+// after an outage without waiting for regular invocations to do it.
+func RunMetricsReplay() error {
+	ctx := context.Background()
+
+	for {
+		drained, err := replaySpooledMetrics(ctx, sendInfluxLines)
+		if err != nil {
+			return err
+		}
+		if drained == 0 {
+			slog.InfoContext(ctx, "Metrics spool is empty")
+			return nil
+		}
+	}
+}
+
+// dirSpool keeps batches as files in a local directory, up to maxBytes of
+// them; beyond that the oldest are dropped.
+type dirSpool struct {
+	dir      string
+	maxBytes int64
+}
+
+func (d *dirSpool) Save(ctx context.Context, lines []string) (string, error) {
+	if err := os.MkdirAll(d.dir, 0o755); err != nil {
+		return "", err
+	}
+
+	// Write then rename, so a batch is never replayed half written
+	path := filepath.Join(d.dir, spoolBatchName())
+	if err := os.WriteFile(path+".tmp", []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return "", err
+	}
+
+	d.prune(ctx, filepath.Base(path))
+	return path, nil
+}
+
+// prune drops the oldest batches, rejected ones included, until the spool
+// fits in maxBytes again. The batch just saved is always kept.
+func (d *dirSpool) prune(ctx context.Context, keep string) {
+	type batch struct {
+		name string
+		path string
+		size int64
+	}
+
+	var batches []batch
+	var total int64
+	for _, dir := range []string{d.dir, filepath.Join(d.dir, rejectedSpoolDir)} {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			info, err := entry.Info()
+			if err != nil || !strings.HasSuffix(entry.Name(), spoolSuffix) {
+				continue
+			}
+			batches = append(batches, batch{name: entry.Name(), path: filepath.Join(dir, entry.Name()), size: info.Size()})
+			total += info.Size()
+		}
+	}
+	if total <= d.maxBytes {
+		return
+	}
+
+	sort.Slice(batches, func(i, j int) bool { return batches[i].name < batches[j].name })
+
+	dropped := 0
+	for _, b := range batches {
+		if total <= d.maxBytes {
+			break
+		}
+		if b.name == keep {
+			continue
+		}
+		if err := os.Remove(b.path); err != nil {
+			continue
+		}
+		total -= b.size
+		dropped++
+	}
+
+	slog.WarnContext(ctx, "Metrics spool is full, dropped the oldest batches", "batches", dropped, "max_bytes", d.maxBytes)
+}
+
+func (d *dirSpool) List(ctx context.Context, limit int) ([]string, error) {
+	entries, err := os.ReadDir(d.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), spoolSuffix) {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	if len(names) > limit {
+		names = names[:limit]
+	}
+	return names, nil
+}
+
+func (d *dirSpool) Load(ctx context.Context, name string) ([]string, error) {
+	file, err := os.Open(filepath.Join(d.dir, name))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return readSpoolLines(file)
+}
+
+func (d *dirSpool) Remove(ctx context.Context, name string) error {
+	return os.Remove(filepath.Join(d.dir, name))
+}
+
+func (d *dirSpool) Reject(ctx context.Context, name string) (string, error) {
+	dir := filepath.Join(d.dir, rejectedSpoolDir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, name)
+	if err := os.Rename(filepath.Join(d.dir, name), path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// s3Spool keeps batches as objects under metrics-spool/ in a bucket, and
+// rejected batches under metrics-spool/rejected/.
+type s3Spool struct {
+	client *s3.Client
+	bucket string
+}
+
+func (s *s3Spool) Save(ctx context.Context, lines []string) (string, error) {
+	key := spoolPrefix + spoolBatchName()
+
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        strings.NewReader(strings.Join(lines, "\n") + "\n"),
+		ContentType: aws.String("text/plain; charset=utf-8"),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("s3://%s/%s", s.bucket, key), nil
+}
+
+func (s *s3Spool) List(ctx context.Context, limit int) ([]string, error) {
+	result, err := s.client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(spoolPrefix),
+		// Rejected batches come back as a common prefix, not as keys
+		Delimiter: aws.String("/"),
+		MaxKeys:   aws.Int32(int32(limit)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(result.Contents))
+	for _, object := range result.Contents {
+		names = append(names, aws.ToString(object.Key))
+	}
+	return names, nil
+}
+
+func (s *s3Spool) Load(ctx context.Context, name string) ([]string, error) {
+	result, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(name),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer result.Body.Close()
+
+	return readSpoolLines(result.Body)
+}
+
+func (s *s3Spool) Remove(ctx context.Context, name string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(name),
+	})
+	return err
+}
+
+func (s *s3Spool) Reject(ctx context.Context, name string) (string, error) {
+	key := spoolPrefix + rejectedSpoolDir + strings.TrimPrefix(name, spoolPrefix)
+
+	_, err := s.client.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:     aws.String(s.bucket),
+		Key:        aws.String(key),
+		CopySource: aws.String(s.bucket + "/" + name),
+	})
+	if err != nil {
+		return "", err
+	}
+	if err := s.Remove(ctx, name); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("s3://%s/%s", s.bucket, key), nil
+}
+
+func readSpoolLines(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
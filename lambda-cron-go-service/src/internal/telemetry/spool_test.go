@@ -0,0 +1,64 @@
+package telemetry
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDirSpoolDropsOldestBatches(t *testing.T) {
+	ctx := context.Background()
+	// Each batch below is 11 bytes; room for two
+	spool := &dirSpool{dir: t.TempDir(), maxBytes: 25}
+
+	var saved []string
+	for _, line := range []string{"m v=1 1000", "m v=2 2000", "m v=3 3000"} {
+		path, err := spool.Save(ctx, []string{line})
+		if err != nil {
+			t.Fatalf("Save() = %v", err)
+		}
+		saved = append(saved, filepath.Base(path))
+	}
+
+	names, err := spool.List(ctx, 10)
+	if err != nil {
+		t.Fatalf("List() = %v", err)
+	}
+	if len(names) != 2 || names[0] != saved[1] || names[1] != saved[2] {
+		t.Fatalf("spool holds %v, want the two newest of %v", names, saved)
+	}
+}
+
+func TestDirSpoolKeepsNewestBatchOverLimit(t *testing.T) {
+	ctx := context.Background()
+	spool := &dirSpool{dir: t.TempDir(), maxBytes: 4}
+
+	if _, err := spool.Save(ctx, []string{"m v=1 1000"}); err != nil {
+		t.Fatalf("Save() = %v", err)
+	}
+	if _, err := spool.Reject(ctx, mustList(t, spool)[0]); err != nil {
+		t.Fatalf("Reject() = %v", err)
+	}
+	path, err := spool.Save(ctx, []string{"m v=2 2000"})
+	if err != nil {
+		t.Fatalf("Save() = %v", err)
+	}
+
+	if names := mustList(t, spool); len(names) != 1 || names[0] != filepath.Base(path) {
+		t.Errorf("spool holds %v, want only the newest batch", names)
+	}
+	rejected, _ := os.ReadDir(filepath.Join(spool.dir, rejectedSpoolDir))
+	if len(rejected) != 0 {
+		t.Errorf("rejected batches were kept over the limit: %d", len(rejected))
+	}
+}
+
+func mustList(t *testing.T, spool *dirSpool) []string {
+	t.Helper()
+	names, err := spool.List(context.Background(), 10)
+	if err != nil {
+		t.Fatalf("List() = %v", err)
+	}
+	return names
+}
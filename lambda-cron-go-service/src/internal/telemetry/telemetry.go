@@ -0,0 +1,48 @@
+// Package telemetry is the logging, metrics and tracing shared by the
+// producer and the worker, along with the cached AWS config and secrets
+// they are built on.
+package telemetry
+
+import (
+	"context"
+	"time"
+)
+
+// Service describes the function recording telemetry.
+type Service struct {
+	// Name is the service name on traces, the function_name tag on every
+	// metric and the Prometheus job
+	Name string
+	// Schema declares every measurement the service writes
+	Schema Schema
+	// Breaker, if set, guards telemetry's calls to its dependencies
+	Breaker CircuitBreaker
+}
+
+// CircuitBreaker guards calls to a dependency, by name. Every call Allow
+// lets through is reported back to Record, with healthy false when the
+// dependency could not answer.
+type CircuitBreaker interface {
+	Allow(ctx context.Context, dependency string, metrics MetricsSink) bool
+	Record(ctx context.Context, dependency string, metrics MetricsSink, healthy bool)
+}
+
+var service = Service{Name: "lambda-cron-go"}
+
+// Init records which service is running and sets up logging. main calls it
+// before anything else.
+func Init(s Service) {
+	service = s
+	setupLogging()
+}
+
+// writeContext bounds a telemetry write to timeout, or to the time the
+// caller has left if that is shorter. It is not cancelled along with the
+// caller, so points an invocation is wrapping up with still land or get
+// spooled.
+func writeContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = min(timeout, time.Until(deadline))
+	}
+	return context.WithTimeout(context.WithoutCancel(ctx), timeout)
+}
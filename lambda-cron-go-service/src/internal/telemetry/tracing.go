@@ -0,0 +1,173 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/smithy-go/middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultTracesFile = "/tmp/traces.jsonl"
+	traceFlushTimeout = 5 * time.Second
+)
+
+// Tracer creates the service's spans. It is a no-op until SetupTracing
+// installs a provider, but W3C trace context is propagated either way.
+func Tracer() trace.Tracer {
+	return otel.Tracer(service.Name)
+}
+
+var (
+	tracerProviderMu sync.Mutex
+	tracerProvider   *sdktrace.TracerProvider
+)
+
+// SetupTracing installs the trace exporter named by OTEL_TRACES_EXPORTER:
+// "otlp" sends spans over OTLP/HTTP to the collector configured by the
+// standard OTEL_EXPORTER_OTLP_* variables (the ADOT Lambda layer listens on
+// localhost:4318), "file" writes them as JSON lines to OTEL_TRACES_FILE
+// (/tmp/traces.jsonl by default) and "none", the default, turns tracing off.
+// OTEL_SERVICE_NAME overrides the service name.
+func SetupTracing(ctx context.Context) error {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch name := os.Getenv("OTEL_TRACES_EXPORTER"); name {
+	case "", "none":
+		return nil
+	case "otlp":
+		exporter, err = otlptracehttp.New(ctx)
+	case "file":
+		path := os.Getenv("OTEL_TRACES_FILE")
+		if path == "" {
+			path = defaultTracesFile
+		}
+		var file *os.File
+		file, err = os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err == nil {
+			exporter, err = stdouttrace.New(stdouttrace.WithWriter(file))
+		}
+	default:
+		return fmt.Errorf("unknown trace exporter %q", name)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create trace exporter: %w", err)
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", service.Name)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to describe trace resource: %w", err)
+	}
+
+	tracerProviderMu.Lock()
+	defer tracerProviderMu.Unlock()
+
+	tracerProvider = sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(tracerProvider)
+	return nil
+}
+
+// FlushTraces exports the spans ended so far. Lambda freezes the
+// environment once the handler returns, so every invocation flushes before
+// answering.
+func FlushTraces(ctx context.Context) {
+	tracerProviderMu.Lock()
+	provider := tracerProvider
+	tracerProviderMu.Unlock()
+
+	if provider == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), traceFlushTimeout)
+	defer cancel()
+
+	if err := provider.ForceFlush(ctx); err != nil {
+		slog.WarnContext(ctx, "Failed to export traces", "error", err)
+	}
+}
+
+// ShutdownTracing flushes and stops the exporter when a long-running mode
+// exits.
+func ShutdownTracing() {
+	tracerProviderMu.Lock()
+	defer tracerProviderMu.Unlock()
+
+	if tracerProvider == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), traceFlushTimeout)
+	defer cancel()
+
+	if err := tracerProvider.Shutdown(ctx); err != nil {
+		slog.Warn("Failed to export traces", "error", err)
+	}
+}
+
+// EndSpan records err, if any, on span and ends it.
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// traceAWSCalls wraps every AWS SDK call made with the shared config in a
+// client span named after the service and operation, such as SQS.SendMessage.
+func traceAWSCalls(stack *middleware.Stack) error {
+	// After the SDK's own initialize middleware, which names the operation
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("TraceAWSCall",
+		func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+			awsService, operation := awsmiddleware.GetServiceID(ctx), awsmiddleware.GetOperationName(ctx)
+
+			ctx, span := Tracer().Start(ctx, awsService+"."+operation,
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(
+					attribute.String("rpc.system", "aws-api"),
+					attribute.String("rpc.service", awsService),
+					attribute.String("rpc.method", operation),
+				))
+
+			out, metadata, err := next.HandleInitialize(ctx, in)
+			EndSpan(span, err)
+			return out, metadata, err
+		}), middleware.After)
+}
+
+// InjectTraceAttributes adds ctx's trace context to attrs so the message
+// continues the current trace when it is processed.
+func InjectTraceAttributes(ctx context.Context, attrs map[string]types.MessageAttributeValue) map[string]types.MessageAttributeValue {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	for key, value := range carrier {
+		attrs[key] = types.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(value),
+		}
+	}
+	return attrs
+}
@@ -0,0 +1,287 @@
+// Package workstatus records work item state transitions in the DynamoDB
+// status table the producer and worker share.
+package workstatus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Work item states recorded in the status table. The producer writes
+// queued, pending for items waiting on dependencies, or skipped for items
+// of paused work types; the worker writes every later state, including
+// releasing pending items or skipping them when a dependency fails. A
+// workflow item waiting for its execution to end is running.
+const (
+	Pending      = "pending"
+	Queued       = "queued"
+	InProgress   = "in_progress"
+	Running      = "running"
+	Retrying     = "retrying"
+	Succeeded    = "succeeded"
+	Failed       = "failed"
+	DeadLettered = "dead_lettered"
+	Skipped      = "skipped"
+)
+
+// ErrChanged is returned by Record when ExpectedStatus no longer matches
+// the stored status, or when ClaimForParent finds the work ID taken.
+var ErrChanged = errors.New("work item status changed")
+
+// retention is how long status records are kept before DynamoDB expires
+// them.
+const retention = 30 * 24 * time.Hour
+
+// Transition is a single state change for a work item.
+type Transition struct {
+	RunId         string
+	WorkId        int
+	WorkType      string
+	Status        string
+	MessageId     string
+	CorrelationId string
+	Attempt       int
+	Error         *string
+	// DependsOn and Body are stored for pending items so the worker can
+	// check their dependencies and enqueue them once released
+	DependsOn []int
+	Body      string
+	// ParentWorkId links a child work item to the item that emitted it
+	ParentWorkId int
+	// ExpectedStatus makes the write conditional on the current status
+	ExpectedStatus string
+	// ClaimForParent makes the write conditional on the work ID being
+	// unused in the run, or a queued child of ParentWorkId that was never
+	// sent
+	ClaimForParent bool
+}
+
+// State is a status record as read back from the table. Items held back
+// for their dependencies carry the serialized work item in Body so the
+// worker can enqueue them once released.
+type State struct {
+	RunId        string `dynamodbav:"runId"`
+	WorkId       int    `dynamodbav:"workId"`
+	WorkType     string `dynamodbav:"workType"`
+	Status       string `dynamodbav:"status"`
+	DependsOn    []int  `dynamodbav:"dependsOn"`
+	Body         string `dynamodbav:"body"`
+	ParentWorkId int    `dynamodbav:"parentWorkId"`
+}
+
+// Store writes work item state transitions to the DynamoDB table named by
+// STATUS_TABLE_NAME. Items are keyed by run ID and work ID.
+type Store struct {
+	client    *dynamodb.Client
+	tableName string
+}
+
+// NewStore returns nil when status tracking is not configured.
+func NewStore(cfg aws.Config) *Store {
+	tableName := os.Getenv("STATUS_TABLE_NAME")
+	if tableName == "" {
+		return nil
+	}
+
+	return &Store{client: dynamodb.NewFromConfig(cfg), tableName: tableName}
+}
+
+// Record sets the item's current status and appends the transition to its
+// history.
+func (s *Store) Record(ctx context.Context, t Transition) error {
+	now := time.Now().UTC()
+	nowValue := &ddbtypes.AttributeValueMemberS{Value: now.Format(time.RFC3339Nano)}
+
+	transition := map[string]ddbtypes.AttributeValue{
+		"status": &ddbtypes.AttributeValueMemberS{Value: t.Status},
+		"at":     nowValue,
+	}
+
+	update := "SET #status = :status, workType = :workType, typeStatus = :typeStatus, updatedAt = :now, " +
+		"createdAt = if_not_exists(createdAt, :now), expiresAt = :expiresAt, " +
+		"transitions = list_append(if_not_exists(transitions, :empty), :transition)"
+
+	values := map[string]ddbtypes.AttributeValue{
+		":status":     &ddbtypes.AttributeValueMemberS{Value: t.Status},
+		":workType":   &ddbtypes.AttributeValueMemberS{Value: t.WorkType},
+		":typeStatus": &ddbtypes.AttributeValueMemberS{Value: t.WorkType + "#" + t.Status},
+		":now":        nowValue,
+		":expiresAt":  &ddbtypes.AttributeValueMemberN{Value: strconv.FormatInt(now.Add(retention).Unix(), 10)},
+		":empty":      &ddbtypes.AttributeValueMemberL{Value: []ddbtypes.AttributeValue{}},
+	}
+
+	if t.MessageId != "" {
+		update += ", messageId = :messageId"
+		values[":messageId"] = &ddbtypes.AttributeValueMemberS{Value: t.MessageId}
+	}
+	if t.CorrelationId != "" {
+		update += ", correlationId = :correlationId"
+		values[":correlationId"] = &ddbtypes.AttributeValueMemberS{Value: t.CorrelationId}
+	}
+	if t.Attempt > 0 {
+		update += ", attempts = :attempts"
+		values[":attempts"] = &ddbtypes.AttributeValueMemberN{Value: strconv.Itoa(t.Attempt)}
+		transition["attempt"] = values[":attempts"]
+	}
+	if t.ParentWorkId > 0 {
+		update += ", parentWorkId = :parentWorkId"
+		values[":parentWorkId"] = &ddbtypes.AttributeValueMemberN{Value: strconv.Itoa(t.ParentWorkId)}
+	}
+	if t.Error != nil {
+		update += ", lastError = :error"
+		values[":error"] = &ddbtypes.AttributeValueMemberS{Value: *t.Error}
+		transition["error"] = values[":error"]
+	}
+
+	if len(t.DependsOn) > 0 {
+		dependsOn := make([]ddbtypes.AttributeValue, 0, len(t.DependsOn))
+		for _, id := range t.DependsOn {
+			dependsOn = append(dependsOn, &ddbtypes.AttributeValueMemberN{Value: strconv.Itoa(id)})
+		}
+		update += ", dependsOn = :dependsOn"
+		values[":dependsOn"] = &ddbtypes.AttributeValueMemberL{Value: dependsOn}
+	}
+	if t.Body != "" {
+		update += ", body = :body"
+		values[":body"] = &ddbtypes.AttributeValueMemberS{Value: t.Body}
+	}
+
+	values[":transition"] = &ddbtypes.AttributeValueMemberL{Value: []ddbtypes.AttributeValue{
+		&ddbtypes.AttributeValueMemberM{Value: transition},
+	}}
+
+	input := &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(s.tableName),
+		Key:                       key(t.RunId, t.WorkId),
+		UpdateExpression:          aws.String(update),
+		ExpressionAttributeNames:  map[string]string{"#status": "status"},
+		ExpressionAttributeValues: values,
+	}
+	if t.ExpectedStatus != "" {
+		input.ConditionExpression = aws.String("#status = :expected")
+		values[":expected"] = &ddbtypes.AttributeValueMemberS{Value: t.ExpectedStatus}
+	}
+	if t.ClaimForParent {
+		input.ConditionExpression = aws.String("attribute_not_exists(workId) OR " +
+			"(parentWorkId = :parentWorkId AND #status = :queued AND attribute_not_exists(messageId))")
+		values[":parentWorkId"] = &ddbtypes.AttributeValueMemberN{Value: strconv.Itoa(t.ParentWorkId)}
+		values[":queued"] = &ddbtypes.AttributeValueMemberS{Value: Queued}
+	}
+
+	_, err := s.client.UpdateItem(ctx, input)
+	if err != nil {
+		var conditionFailed *ddbtypes.ConditionalCheckFailedException
+		if errors.As(err, &conditionFailed) {
+			return ErrChanged
+		}
+		return fmt.Errorf("failed to record %s status for work item %d: %w", t.Status, t.WorkId, err)
+	}
+
+	return nil
+}
+
+// LinkChildren records the work IDs of the child items a work item emitted.
+func (s *Store) LinkChildren(ctx context.Context, runId string, workId int, childIds []int) error {
+	ids := make([]ddbtypes.AttributeValue, 0, len(childIds))
+	for _, id := range childIds {
+		ids = append(ids, &ddbtypes.AttributeValueMemberN{Value: strconv.Itoa(id)})
+	}
+
+	_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:        aws.String(s.tableName),
+		Key:              key(runId, workId),
+		UpdateExpression: aws.String("SET childWorkIds = :childWorkIds"),
+		ExpressionAttributeValues: map[string]ddbtypes.AttributeValue{
+			":childWorkIds": &ddbtypes.AttributeValueMemberL{Value: ids},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to link child work items of work item %d: %w", workId, err)
+	}
+
+	return nil
+}
+
+// MarkSent records the ID of the message a queued work item was sent in, so
+// a retried fan-out does not claim and send it again.
+func (s *Store) MarkSent(ctx context.Context, runId string, workId int, messageId string) error {
+	_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:        aws.String(s.tableName),
+		Key:              key(runId, workId),
+		UpdateExpression: aws.String("SET messageId = :messageId"),
+		ExpressionAttributeValues: map[string]ddbtypes.AttributeValue{
+			":messageId": &ddbtypes.AttributeValueMemberS{Value: messageId},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to mark work item %d sent: %w", workId, err)
+	}
+
+	return nil
+}
+
+// Get returns the stored state of a work item, or nil if it has none.
+func (s *Store) Get(ctx context.Context, runId string, workId int) (*State, error) {
+	result, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(s.tableName),
+		Key:            key(runId, workId),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read status of work item %d: %w", workId, err)
+	}
+	if result.Item == nil {
+		return nil, nil
+	}
+
+	var state State
+	if err := attributevalue.UnmarshalMap(result.Item, &state); err != nil {
+		return nil, fmt.Errorf("failed to decode status of work item %d: %w", workId, err)
+	}
+
+	return &state, nil
+}
+
+// ListRun returns the stored state of every work item in a run.
+func (s *Store) ListRun(ctx context.Context, runId string) ([]State, error) {
+	var states []State
+
+	paginator := dynamodb.NewQueryPaginator(s.client, &dynamodb.QueryInput{
+		TableName:              aws.String(s.tableName),
+		KeyConditionExpression: aws.String("runId = :runId"),
+		ExpressionAttributeValues: map[string]ddbtypes.AttributeValue{
+			":runId": &ddbtypes.AttributeValueMemberS{Value: runId},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list work items of run %s: %w", runId, err)
+		}
+
+		var pageStates []State
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageStates); err != nil {
+			return nil, fmt.Errorf("failed to decode work items of run %s: %w", runId, err)
+		}
+		states = append(states, pageStates...)
+	}
+
+	return states, nil
+}
+
+func key(runId string, workId int) map[string]ddbtypes.AttributeValue {
+	return map[string]ddbtypes.AttributeValue{
+		"runId":  &ddbtypes.AttributeValueMemberS{Value: runId},
+		"workId": &ddbtypes.AttributeValueMemberN{Value: strconv.Itoa(workId)},
+	}
+}
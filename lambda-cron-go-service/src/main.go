@@ -3,27 +3,33 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"strconv"
 	"time"
 
 	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-lambda-go/lambdacontext"
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
-	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
-	"github.com/influxdata/influxdb-client-go/v2/api"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"lambda-cron-go-service/internal/pause"
+	"lambda-cron-go-service/internal/telemetry"
+	"lambda-cron-go-service/internal/workstatus"
 )
 
 type CronResponse struct {
-	StatusCode  int         `json:"statusCode"`
-	Timestamp   string      `json:"timestamp"`
-	Environment string      `json:"environment"`
-	CronJob     CronJobData `json:"cronJob"`
+	StatusCode      int         `json:"statusCode"`
+	Timestamp       string      `json:"timestamp"`
+	Environment     string      `json:"environment"`
+	CronJob         CronJobData `json:"cronJob"`
+	MetricsErrors   int         `json:"metricsErrors"`
+	MetricsDegraded bool        `json:"metricsDegraded"`
 }
 
 type CronJobData struct {
@@ -33,7 +39,13 @@ type CronJobData struct {
 }
 
 type ProcessedData struct {
+	RunId           string        `json:"runId"`
+	Schedule        string        `json:"schedule"`
+	Skipped         bool          `json:"skipped,omitempty"`
+	SkipReason      string        `json:"skipReason,omitempty"`
 	MessagesSent    []MessageSent `json:"messagesSent"`
+	PendingItems    []int         `json:"pendingItems"`
+	SkippedItems    []int         `json:"skippedItems"`
 	ExecutionTimeMs int64         `json:"executionTimeMs"`
 	Timestamp       string        `json:"timestamp"`
 }
@@ -45,126 +57,248 @@ type MessageSent struct {
 }
 
 type WorkItem struct {
-	ID      int                    `json:"id"`
-	Type    string                 `json:"type"`
-	Payload map[string]interface{} `json:"payload"`
+	ID            int                    `json:"id"`
+	Type          string                 `json:"type"`
+	Payload       map[string]interface{} `json:"payload"`
+	CorrelationId string                 `json:"correlationId,omitempty"`
+	RunId         string                 `json:"runId,omitempty"`
+	DependsOn     []int                  `json:"dependsOn,omitempty"`
 }
 
-type InfluxDBCredentials struct {
-	Token string `json:"token"`
+func Handler(ctx context.Context, event interface{}) (CronResponse, error) {
+	defer telemetry.FlushTraces(ctx)
+
+	slog.InfoContext(ctx, "Cron job triggered")
+	slog.DebugContext(ctx, "Cron job event", "event", event)
+
+	// The run ID groups this invocation's items in the status table, and
+	// correlation IDs tie each item's worker activity and completion event
+	// back to it
+	runId := fmt.Sprintf("local-%d", time.Now().UnixNano())
+	if lc, ok := lambdacontext.FromContext(ctx); ok {
+		runId = lc.AwsRequestID
+	}
+
+	// Rules for named schedules pass {"schedule": "<name>"} as their input;
+	// the plain hourly rule sends the default work items
+	schedule := defaultSchedule
+	if input, ok := event.(map[string]interface{}); ok {
+		if name, ok := input["schedule"].(string); ok && name != "" {
+			found, err := findSchedule(name)
+			if err != nil {
+				errMsg := fmt.Sprintf("Failed to resolve schedule %q: %v", name, err)
+				slog.ErrorContext(ctx, errMsg)
+				return createErrorResponse(errMsg), err
+			}
+			schedule = found
+		}
+	}
+
+	return dispatch(ctx, runId, schedule)
 }
 
+// defaultWorkItems is the work sent on every run of the hourly rule. The
+// workflow item is only sent when a state machine is configured.
+func defaultWorkItems() []WorkItem {
+	workItems := []WorkItem{
+		{ID: 1, Type: "data_processing", Payload: map[string]interface{}{"userId": 123, "action": "update_profile", "profile": map[string]interface{}{"locale": "en-US"}}},
+		{ID: 2, Type: "email_notification", Payload: map[string]interface{}{"email": "user@example.com", "template": "welcome"}},
+		{ID: 3, Type: "data_cleanup", Payload: map[string]interface{}{"table": "old_logs", "days": 30}},
+		{ID: 4, Type: "report_generation", Payload: map[string]interface{}{"reportType": "monthly", "userId": 456, "notifyEmail": "user@example.com"}, DependsOn: []int{3}},
+		{ID: 5, Type: "backup_task", Payload: map[string]interface{}{"database": "main", "retention": 7}},
+	}
+
+	if os.Getenv("WORKFLOW_STATE_MACHINE_ARN") != "" {
+		workItems = append(workItems, WorkItem{ID: 6, Type: "workflow", Payload: map[string]interface{}{"data": map[string]interface{}{"source": "lambda-cron-go"}, "waitForCompletion": true}})
+	}
 
-func Handler(ctx context.Context, event interface{}) (CronResponse, error) {
-	log.Printf("Cron job triggered at: %s", time.Now().UTC().Format(time.RFC3339))
-	log.Printf("Event: %+v", event)
+	return workItems
+}
 
+// dispatch sends one run of a schedule's work items to the work queue. It is
+// shared by the Lambda handler and the scheduler daemon.
+func dispatch(ctx context.Context, runId string, schedule *Schedule) (response CronResponse, err error) {
 	var processedData *ProcessedData
-	var influxClient influxdb2.Client
-	var writeAPI api.WriteAPI
+
+	// Every work item's processing in the worker joins this run's trace
+	ctx, span := telemetry.Tracer().Start(ctx, "dispatch", trace.WithAttributes(
+		attribute.String("run_id", runId),
+		attribute.String("schedule", schedule.Name)))
+	defer func() { telemetry.EndSpan(span, err) }()
 
 	startTime := time.Now()
 
-	// Initialize AWS config with automatic region detection
-	cfg, err := config.LoadDefaultConfig(ctx)
+	// Clients are created once per execution environment and reused by
+	// warm invocations
+	cfg, err := telemetry.GetAWSConfig(ctx)
 	if err != nil {
 		return createErrorResponse(fmt.Sprintf("Failed to load AWS config: %v", err)), err
 	}
 
-	secretsMgr := secretsmanager.NewFromConfig(cfg)
+	ctx = telemetry.WithLogAttrs(ctx, slog.String("run_id", runId), slog.String("schedule", schedule.Name))
+
 	sqsClient := sqs.NewFromConfig(cfg)
+	statuses := workstatus.NewStore(cfg)
 
+	metrics, metricsDegraded, err := telemetry.GetMetricsSink(ctx)
+	if err != nil {
+		errMsg := fmt.Sprintf("Failed to set up metrics: %v", err)
+		slog.ErrorContext(ctx, errMsg)
+		return createErrorResponse(errMsg), err
+	}
+
+	// Write out the run's metrics before answering so failed writes are
+	// reported, whichever way the run ends; nothing may be left buffered
+	// when Lambda freezes the environment
 	defer func() {
-		if writeAPI != nil {
-			writeAPI.Flush()
-			if influxClient != nil {
-				influxClient.Close()
-			}
-			log.Println("InfluxDB connection closed")
+		metricsErrors, metricsErr := telemetry.FlushMetrics(ctx, metrics)
+		response.MetricsErrors = metricsErrors
+		response.MetricsDegraded = metricsDegraded
+		if metricsErr != nil && err == nil {
+			errMsg := metricsErr.Error()
+			response.StatusCode = 500
+			response.CronJob.Success = false
+			response.CronJob.Error = &errMsg
+			err = metricsErr
 		}
 	}()
 
-	// Get InfluxDB credentials from AWS Secrets Manager
-	secretArn := os.Getenv("INFLUXDB_SECRET_ARN")
-	secretInput := &secretsmanager.GetSecretValueInput{
-		SecretId:     aws.String(secretArn),
-		VersionStage: aws.String("AWSCURRENT"),
+	environment := os.Getenv("ENVIRONMENT")
+
+	// Calendar rules may rule this run out; record why instead of quietly
+	// sending nothing
+	if schedule.Calendar != nil {
+		reason, err := schedule.Calendar.skipReason(startTime)
+		if err != nil {
+			errMsg := fmt.Sprintf("Failed to evaluate calendar rules for schedule %q: %v", schedule.Name, err)
+			slog.ErrorContext(ctx, errMsg)
+			return createErrorResponse(errMsg), err
+		}
+		if reason != "" {
+			return skippedRunResponse(ctx, metrics, runId, schedule, reason, startTime), nil
+		}
+	}
+
+	// The kill switch stops every run until it is lifted
+	pauses := pause.Current(ctx, "producer", metrics)
+	if pauses.KillSwitch {
+		return skippedRunResponse(ctx, metrics, runId, schedule, "kill_switch", startTime), nil
 	}
 
-	secretResult, err := secretsMgr.GetSecretValue(ctx, secretInput)
+	// Record cron job start
+	metrics.Event("cron_job_execution", telemetry.Tags{
+		"status":   "started",
+		"schedule": schedule.Name,
+	}, telemetry.Fields{
+		"execution_start": 1,
+	})
+
+	workItems, err := schedule.resolveWorkItems()
 	if err != nil {
-		errMsg := fmt.Sprintf("Failed to retrieve secret: %v", err)
-		log.Println(errMsg)
+		errMsg := fmt.Sprintf("Failed to resolve work items: %v", err)
+		slog.ErrorContext(ctx, errMsg)
 		return createErrorResponse(errMsg), err
 	}
 
-	var credentials InfluxDBCredentials
-	if err := json.Unmarshal([]byte(*secretResult.SecretString), &credentials); err != nil {
-		errMsg := fmt.Sprintf("Failed to parse credentials: %v", err)
-		log.Println(errMsg)
-		return createErrorResponse(errMsg), err
+	if schedule.MaxItems > 0 && len(workItems) > schedule.MaxItems {
+		errMsg := fmt.Sprintf("Schedule %q resolved %d work items, more than its limit of %d", schedule.Name, len(workItems), schedule.MaxItems)
+		slog.ErrorContext(ctx, errMsg)
+		return createErrorResponse(errMsg), errors.New(errMsg)
 	}
 
-	influxURL := os.Getenv("INFLUXDB_URL")
-	influxOrg := os.Getenv("INFLUXDB_ORG")
-	influxBucket := os.Getenv("INFLUXDB_BUCKET")
-	environment := os.Getenv("ENVIRONMENT")
+	queueURL := schedule.QueueURL
+	if queueURL == "" {
+		queueURL = os.Getenv("SQS_QUEUE_URL")
+	}
+	if queueURL == "" {
+		errMsg := "SQS_QUEUE_URL environment variable is not set"
+		slog.ErrorContext(ctx, errMsg)
+		return createErrorResponse(errMsg), errors.New(errMsg)
+	}
 
-	log.Printf("InfluxDB client initialized with URL: %s", influxURL)
-	log.Printf("Using InfluxDB organization: %s", influxOrg)
-	log.Printf("Using InfluxDB bucket: %s", influxBucket)
+	slog.InfoContext(ctx, "Dispatching run", "work_items", len(workItems))
 
-	// Initialize InfluxDB client
-	influxClient = influxdb2.NewClientWithOptions(
-		influxURL,
-		credentials.Token,
-		influxdb2.DefaultOptions().SetUseGZip(true),
-	)
+	for i := range workItems {
+		workItems[i].RunId = runId
+		workItems[i].CorrelationId = fmt.Sprintf("%s-%d", runId, workItems[i].ID)
+	}
 
-	writeAPI = influxClient.WriteAPI(influxOrg, influxBucket)
-	// WriteAPI options can be set if needed
+	// Types paused with "skip" are not sent this run; "hold" types are sent
+	// and held on the queue by the worker
+	kept, skipReasons := skipPausedItems(workItems, pauses)
+	skippedItems := []int{}
+	for _, item := range workItems {
+		if reason, skipped := skipReasons[item.ID]; skipped {
+			slog.InfoContext(itemLogContext(ctx, item), "Skipping work item", "reason", reason)
+			recordStatus(ctx, statuses, item, workstatus.Skipped, &reason)
+			skippedItems = append(skippedItems, item.ID)
+		} else if pauses.Mode(item.Type) == "hold" {
+			slog.InfoContext(itemLogContext(ctx, item), "Work type is paused, the worker will hold the work item")
+		}
+	}
+	workItems = kept
 
-	log.Println("Connected to InfluxDB")
+	if err := validateDependencies(workItems); err != nil {
+		errMsg := fmt.Sprintf("Invalid work item dependencies: %v", err)
+		slog.ErrorContext(ctx, errMsg)
+		return createErrorResponse(errMsg), err
+	}
 
-	// Log cron job start to InfluxDB
-	cronStartPoint := influxdb2.NewPointWithMeasurement("cron_job_execution").
-		AddTag("status", "started").
-		AddTag("function_name", "lambda-cron-go").
-		AddField("execution_start", 1).
-		SetTime(time.Now())
+	// Items with dependencies are held in the status table until the worker
+	// releases them. They are recorded before anything is sent so a fast
+	// worker cannot finish a dependency before its dependents exist. Without
+	// a status table nothing could release them, so they are skipped.
+	pendingItems := []int{}
+	var readyItems []WorkItem
+	for _, item := range workItems {
+		if len(item.DependsOn) == 0 {
+			readyItems = append(readyItems, item)
+			continue
+		}
 
-	writeAPI.WritePoint(cronStartPoint)
+		if statuses == nil {
+			slog.WarnContext(itemLogContext(ctx, item), "Skipping work item, its dependencies cannot be tracked without STATUS_TABLE_NAME",
+				"depends_on", item.DependsOn)
+			skippedItems = append(skippedItems, item.ID)
+			continue
+		}
 
-	// Example work items to process
-	workItems := []WorkItem{
-		{ID: 1, Type: "data_processing", Payload: map[string]interface{}{"userId": 123, "action": "update_profile"}},
-		{ID: 2, Type: "email_notification", Payload: map[string]interface{}{"email": "user@example.com", "template": "welcome"}},
-		{ID: 3, Type: "data_cleanup", Payload: map[string]interface{}{"table": "old_logs", "days": 30}},
-		{ID: 4, Type: "report_generation", Payload: map[string]interface{}{"reportType": "monthly", "userId": 456}},
-		{ID: 5, Type: "backup_task", Payload: map[string]interface{}{"database": "main", "retention": 7}},
-	}
+		if err := recordPending(ctx, statuses, item); err != nil {
+			errMsg := fmt.Sprintf("Failed to hold work item %d for its dependencies: %v", item.ID, err)
+			slog.ErrorContext(ctx, errMsg)
+			return createErrorResponse(errMsg), err
+		}
 
-	queueURL := os.Getenv("SQS_QUEUE_URL")
-	if queueURL == "" {
-		errMsg := "SQS_QUEUE_URL environment variable is not set"
-		log.Println(errMsg)
-		return createErrorResponse(errMsg), fmt.Errorf(errMsg)
+		pendingItems = append(pendingItems, item.ID)
+		slog.InfoContext(itemLogContext(ctx, item), "Holding work item for its dependencies", "depends_on", item.DependsOn)
 	}
 
-	// Process each work item by sending to SQS
+	// Process each ready work item by sending to SQS
 	var messagesSent []MessageSent
-	for _, item := range workItems {
+	for _, item := range readyItems {
+		// Record the item as queued before sending so the worker's
+		// transitions always land after it
+		recordStatus(ctx, statuses, item, workstatus.Queued, nil)
+
 		messageBody, err := json.Marshal(item)
 		if err != nil {
 			errMsg := fmt.Sprintf("Failed to marshal work item %d: %v", item.ID, err)
-			log.Println(errMsg)
+			slog.ErrorContext(ctx, errMsg)
 			return createErrorResponse(errMsg), err
 		}
 
+		sendCtx, sendSpan := telemetry.Tracer().Start(ctx, "send work item",
+			trace.WithSpanKind(trace.SpanKindProducer),
+			trace.WithAttributes(
+				attribute.String("messaging.system", "aws_sqs"),
+				attribute.Int("work_id", item.ID),
+				attribute.String("work_type", item.Type),
+			))
+
 		messageParams := &sqs.SendMessageInput{
 			QueueUrl:    aws.String(queueURL),
 			MessageBody: aws.String(string(messageBody)),
-			MessageAttributes: map[string]types.MessageAttributeValue{
+			MessageAttributes: telemetry.InjectTraceAttributes(sendCtx, map[string]types.MessageAttributeValue{
 				"workType": {
 					DataType:    aws.String("String"),
 					StringValue: aws.String(item.Type),
@@ -173,13 +307,20 @@ func Handler(ctx context.Context, event interface{}) (CronResponse, error) {
 					DataType:    aws.String("Number"),
 					StringValue: aws.String(strconv.Itoa(item.ID)),
 				},
-			},
+				// The worker measures each item's end-to-end latency from here
+				"enqueuedAt": {
+					DataType:    aws.String("Number"),
+					StringValue: aws.String(strconv.FormatInt(time.Now().UnixMilli(), 10)),
+				},
+			}),
 		}
 
-		result, err := sqsClient.SendMessage(ctx, messageParams)
+		result, err := sqsClient.SendMessage(sendCtx, messageParams)
+		telemetry.EndSpan(sendSpan, err)
 		if err != nil {
 			errMsg := fmt.Sprintf("Failed to send work item %d to SQS: %v", item.ID, err)
-			log.Println(errMsg)
+			slog.ErrorContext(ctx, errMsg)
+			recordStatus(ctx, statuses, item, workstatus.Failed, &errMsg)
 			return createErrorResponse(errMsg), err
 		}
 
@@ -189,42 +330,46 @@ func Handler(ctx context.Context, event interface{}) (CronResponse, error) {
 			Type:      item.Type,
 		})
 
-		log.Printf("Sent work item %d (%s) to SQS: %s", item.ID, item.Type, *result.MessageId)
-
-		// Log SQS message metrics to InfluxDB
-		sqsPoint := influxdb2.NewPointWithMeasurement("sqs_messages").
-			AddTag("work_type", item.Type).
-			AddTag("status", "sent").
-			AddField("work_id", item.ID).
-			AddField("message_id", *result.MessageId).
-			SetTime(time.Now())
+		slog.InfoContext(itemLogContext(ctx, item), "Sent work item to SQS", "message_id", *result.MessageId)
 
-		writeAPI.WritePoint(sqsPoint)
+		// Record SQS message metrics
+		metrics.Event("sqs_messages", telemetry.Tags{
+			"work_type": item.Type,
+			"schedule":  schedule.Name,
+			"status":    "sent",
+		}, telemetry.Fields{
+			"work_id":    item.ID,
+			"message_id": *result.MessageId,
+		})
 	}
 
 	executionDuration := time.Since(startTime)
 	processedData = &ProcessedData{
+		RunId:           runId,
+		Schedule:        schedule.Name,
 		MessagesSent:    messagesSent,
+		PendingItems:    pendingItems,
+		SkippedItems:    skippedItems,
 		ExecutionTimeMs: executionDuration.Milliseconds(),
 		Timestamp:       time.Now().UTC().Format(time.RFC3339),
 	}
 
-	// Log successful cron job completion to InfluxDB
-	cronCompletePoint := influxdb2.NewPointWithMeasurement("cron_job_execution").
-		AddTag("status", "completed").
-		AddTag("function_name", "lambda-cron-go").
-		AddField("messages_sent", len(messagesSent)).
-		AddField("execution_duration_ms", executionDuration.Milliseconds()).
-		SetTime(time.Now())
-
-	writeAPI.WritePoint(cronCompletePoint)
-
-	// Ensure all InfluxDB writes are flushed
-	writeAPI.Flush()
-
-	log.Printf("Cron job completed successfully: %+v", processedData)
-
-	response := CronResponse{
+	// Record successful cron job completion
+	metrics.Event("cron_job_execution", telemetry.Tags{
+		"status":   "completed",
+		"schedule": schedule.Name,
+	}, telemetry.Fields{
+		"messages_sent":         len(messagesSent),
+		"execution_duration_ms": executionDuration.Milliseconds(),
+	})
+
+	slog.InfoContext(ctx, "Cron job completed",
+		"messages_sent", len(messagesSent),
+		"pending_items", len(pendingItems),
+		"skipped_items", len(skippedItems),
+		"execution_time_ms", processedData.ExecutionTimeMs)
+
+	response = CronResponse{
 		StatusCode:  200,
 		Timestamp:   time.Now().UTC().Format(time.RFC3339),
 		Environment: environment,
@@ -235,10 +380,49 @@ func Handler(ctx context.Context, event interface{}) (CronResponse, error) {
 		},
 	}
 
-	log.Printf("Cron job result: %+v", response)
 	return response, nil
 }
 
+// skippedRunResponse records a run that calendar rules skipped.
+func skippedRunResponse(ctx context.Context, metrics telemetry.MetricsSink, runId string, schedule *Schedule, reason string, startTime time.Time) CronResponse {
+	slog.InfoContext(ctx, "Skipping run", "reason", reason)
+
+	// Record skipped cron job
+	metrics.Event("cron_job_execution", telemetry.Tags{
+		"status":      "skipped",
+		"schedule":    schedule.Name,
+		"skip_reason": reason,
+	}, telemetry.Fields{
+		"execution_skipped": 1,
+	})
+
+	return CronResponse{
+		StatusCode:  200,
+		Timestamp:   time.Now().UTC().Format(time.RFC3339),
+		Environment: os.Getenv("ENVIRONMENT"),
+		CronJob: CronJobData{
+			Success: true,
+			Error:   nil,
+			ProcessedData: &ProcessedData{
+				RunId:           runId,
+				Schedule:        schedule.Name,
+				Skipped:         true,
+				SkipReason:      reason,
+				MessagesSent:    []MessageSent{},
+				PendingItems:    []int{},
+				SkippedItems:    []int{},
+				ExecutionTimeMs: time.Since(startTime).Milliseconds(),
+				Timestamp:       time.Now().UTC().Format(time.RFC3339),
+			},
+		},
+	}
+}
+
+// itemLogContext adds a work item's correlation fields to ctx.
+func itemLogContext(ctx context.Context, item WorkItem) context.Context {
+	return telemetry.WithLogAttrs(ctx, slog.Int("work_id", item.ID), slog.String("work_type", item.Type))
+}
+
 func createErrorResponse(errorMessage string) CronResponse {
 	environment := os.Getenv("ENVIRONMENT")
 	if environment == "" {
@@ -257,6 +441,32 @@ func createErrorResponse(errorMessage string) CronResponse {
 	}
 }
 
+// main runs the producer as a Lambda invoked by EventBridge, or as a
+// standalone scheduler daemon when PRODUCER_MODE is "scheduler".
 func main() {
+	telemetry.Init(telemetry.Service{Name: "lambda-cron-go", Schema: metricsSchema})
+	if err := telemetry.SetupTracing(context.Background()); err != nil {
+		slog.Warn("Tracing disabled", "error", err)
+	}
+
+	switch os.Getenv("PRODUCER_MODE") {
+	case "scheduler":
+		err := runScheduler()
+		telemetry.ShutdownTracing()
+		if err != nil {
+			slog.Error("Scheduler failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	case "replay-metrics":
+		err := telemetry.RunMetricsReplay()
+		telemetry.ShutdownTracing()
+		if err != nil {
+			slog.Error("Metrics replay failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	lambda.Start(Handler)
-}
\ No newline at end of file
+}
@@ -0,0 +1,20 @@
+package main
+
+import "lambda-cron-go-service/internal/telemetry"
+
+// metricsSchema is every measurement the producer writes. A tag declared as a
+// field, such as message_id, is written as a field instead.
+var metricsSchema = telemetry.Schema{
+	"cron_job_execution": {
+		Tags:   []string{"status", "schedule", "skip_reason"},
+		Fields: []string{"execution_start", "messages_sent", "execution_duration_ms", "execution_skipped"},
+	},
+	"sqs_messages": {
+		Tags:   []string{"work_type", "schedule", "status"},
+		Fields: []string{"work_id", "message_id"},
+	},
+	"work_type_pause": {
+		Tags:   []string{"work_type", "state", "component"},
+		Fields: []string{"paused"},
+	},
+}
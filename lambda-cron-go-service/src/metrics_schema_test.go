@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+
+	"lambda-cron-go-service/internal/telemetry"
+)
+
+// emittedPoints is every point the producer writes, with the tags and
+// fields its code sets.
+var emittedPoints = []struct {
+	name   string
+	tags   telemetry.Tags
+	fields telemetry.Fields
+}{
+	{"cron_job_execution", telemetry.Tags{"status": "started", "schedule": "default"}, telemetry.Fields{"execution_start": 1}},
+	{"cron_job_execution", telemetry.Tags{"status": "completed", "schedule": "default"}, telemetry.Fields{"messages_sent": 5, "execution_duration_ms": int64(120)}},
+	{"cron_job_execution", telemetry.Tags{"status": "skipped", "schedule": "default", "skip_reason": "holiday"}, telemetry.Fields{"execution_skipped": 1}},
+	{"sqs_messages", telemetry.Tags{"work_type": "backup_task", "schedule": "default", "status": "sent"}, telemetry.Fields{"work_id": 1, "message_id": "m-1"}},
+	{"work_type_pause", telemetry.Tags{"work_type": "backup_task", "state": "paused", "component": "producer"}, telemetry.Fields{"paused": true}},
+}
+
+func TestMetricsSchema(t *testing.T) {
+	if err := metricsSchema.Validate(); err != nil {
+		t.Fatalf("metrics schema is invalid: %v", err)
+	}
+
+	emitted := map[string]bool{}
+	for _, point := range emittedPoints {
+		emitted[point.name] = true
+		if err := metricsSchema.Check(point.name, point.tags, point.fields); err != nil {
+			t.Errorf("%s point breaks the metrics schema: %v", point.name, err)
+		}
+	}
+
+	for name := range metricsSchema {
+		if !emitted[name] {
+			t.Errorf("measurement %s is in the metrics schema but has no emitted point", name)
+		}
+	}
+}
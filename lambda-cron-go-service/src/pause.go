@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+
+	"lambda-cron-go-service/internal/pause"
+)
+
+// skipPausedItems drops work items whose type is paused with "skip",
+// together with every item that depends on one of them, since those could
+// never be released.
+func skipPausedItems(workItems []WorkItem, config pause.Config) ([]WorkItem, map[int]string) {
+	skipped := map[int]string{}
+	for _, item := range workItems {
+		if config.Mode(item.Type) == "skip" {
+			skipped[item.ID] = fmt.Sprintf("work type %s is paused", item.Type)
+		}
+	}
+
+	for changed := len(skipped) > 0; changed; {
+		changed = false
+		for _, item := range workItems {
+			if _, done := skipped[item.ID]; done {
+				continue
+			}
+			for _, dependency := range item.DependsOn {
+				if _, ok := skipped[dependency]; ok {
+					skipped[item.ID] = fmt.Sprintf("dependency %d was skipped", dependency)
+					changed = true
+					break
+				}
+			}
+		}
+	}
+
+	kept := make([]WorkItem, 0, len(workItems)-len(skipped))
+	for _, item := range workItems {
+		if _, ok := skipped[item.ID]; !ok {
+			kept = append(kept, item)
+		}
+	}
+
+	return kept, skipped
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// maxMissedRuns bounds how many missed run times are counted after a long
+// outage.
+const maxMissedRuns = 10000
+
+// runScheduler runs the producer as a long-lived daemon that dispatches each
+// schedule in the schedules file on its cron expression, instead of
+// waiting for EventBridge to invoke Handler. Every run goes through the
+// same dispatch as the Lambda.
+//
+// Last run times are kept in SCHEDULER_STATE_FILE when it is set, so runs
+// missed while the daemon was down are handled by each schedule's
+// missed-run policy on the next start. SIGTERM or SIGINT stops the daemon
+// once runs in progress have finished.
+func runScheduler() error {
+	config, err := loadScheduleConfig(schedulesConfigPath())
+	if err != nil {
+		return err
+	}
+
+	state, err := loadSchedulerState(os.Getenv("SCHEDULER_STATE_FILE"))
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	var wg sync.WaitGroup
+	for i := range config.Schedules {
+		schedule := &config.Schedules[i]
+		if schedule.spec == nil {
+			slog.Info("Schedule has no cron expression, it only runs when invoked by name", "schedule", schedule.Name)
+			continue
+		}
+
+		slog.Info("Scheduling schedule",
+			"schedule", schedule.Name,
+			"cron", schedule.Cron,
+			"jitter", schedule.jitter().String(),
+			"missed_run_policy", schedule.MissedRunPolicy)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runSchedule(ctx, schedule, state)
+		}()
+	}
+
+	<-ctx.Done()
+	slog.Info("Shutdown requested, waiting for runs in progress")
+	wg.Wait()
+	slog.Info("Scheduler stopped")
+
+	return nil
+}
+
+// runSchedule dispatches one schedule until ctx is cancelled. Run times that
+// passed while the daemon was down, or while the previous run was still
+// going, are missed: "skip" drops them and "run_once" makes up for all of
+// them with a single immediate run.
+func runSchedule(ctx context.Context, schedule *Schedule, state *schedulerState) {
+	last, ok := state.lastRun(schedule.Name)
+	if !ok {
+		last = time.Now()
+	}
+
+	for ctx.Err() == nil {
+		due := schedule.spec.Next(last)
+
+		if now := time.Now(); due.Before(now) {
+			missed, latest := countMissedRuns(schedule, last, now)
+			last = latest
+
+			if schedule.MissedRunPolicy == missedRunRunOnce {
+				slog.Warn("Schedule missed runs, running once now", "schedule", schedule.Name, "missed", missed, "since", due.Format(time.RFC3339))
+				runScheduled(schedule, latest, state)
+			} else {
+				slog.Warn("Schedule missed runs, skipping them", "schedule", schedule.Name, "missed", missed, "since", due.Format(time.RFC3339))
+				state.setLastRun(schedule.Name, latest)
+			}
+			continue
+		}
+
+		fireAt := due
+		if jitter := schedule.jitter(); jitter > 0 {
+			fireAt = fireAt.Add(time.Duration(rand.Int63n(int64(jitter))))
+		}
+
+		if err := sleepUntil(ctx, fireAt); err != nil {
+			return
+		}
+
+		runScheduled(schedule, due, state)
+		last = due
+	}
+}
+
+// countMissedRuns counts the run times after last up to now and returns the
+// latest of them.
+func countMissedRuns(schedule *Schedule, last time.Time, now time.Time) (int, time.Time) {
+	missed := 0
+	for next := schedule.spec.Next(last); !next.After(now) && missed < maxMissedRuns; next = schedule.spec.Next(next) {
+		missed++
+		last = next
+	}
+	return missed, last
+}
+
+// runScheduled dispatches one run of a schedule. Runs are not tied to the
+// daemon's shutdown signal so a run in progress always completes.
+func runScheduled(schedule *Schedule, scheduledAt time.Time, state *schedulerState) {
+	ctx := context.Background()
+	runId := fmt.Sprintf("%s-%d", schedule.Name, time.Now().UnixNano())
+	slog.Info("Running schedule", "schedule", schedule.Name, "run_id", runId, "scheduled_for", scheduledAt.Format(time.RFC3339))
+
+	if _, err := dispatch(ctx, runId, schedule); err != nil {
+		slog.Error("Scheduled run failed", "schedule", schedule.Name, "run_id", runId, "error", err)
+	}
+
+	// A failed run is not retried on restart; the next scheduled run
+	// carries on as normal
+	state.setLastRun(schedule.Name, scheduledAt)
+}
+
+func sleepUntil(ctx context.Context, at time.Time) error {
+	timer := time.NewTimer(time.Until(at))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// schedulerState tracks the last scheduled time each schedule ran for,
+// persisted to a JSON file when a path is configured.
+type schedulerState struct {
+	mu       sync.Mutex
+	path     string
+	lastRuns map[string]time.Time
+}
+
+func loadSchedulerState(path string) (*schedulerState, error) {
+	state := &schedulerState{path: path, lastRuns: map[string]time.Time{}}
+	if path == "" {
+		return state, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scheduler state: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &state.lastRuns); err != nil {
+		return nil, fmt.Errorf("failed to parse scheduler state: %w", err)
+	}
+
+	return state, nil
+}
+
+func (s *schedulerState) lastRun(name string) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	last, ok := s.lastRuns[name]
+	return last, ok
+}
+
+func (s *schedulerState) setLastRun(name string, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastRuns[name] = at
+	if s.path == "" {
+		return
+	}
+
+	data, err := json.MarshalIndent(s.lastRuns, "", "  ")
+	if err == nil {
+		err = os.WriteFile(s.path, data, 0o644)
+	}
+	if err != nil {
+		slog.Warn("Failed to save scheduler state", "error", err)
+	}
+}
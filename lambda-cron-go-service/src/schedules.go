@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Missed-run policies for the scheduler daemon. A run is missed when its
+// time passes while the daemon is down or still busy with the previous run.
+const (
+	missedRunSkip    = "skip"
+	missedRunRunOnce = "run_once"
+)
+
+// cronParser accepts standard 5-field expressions, an optional leading
+// seconds field and descriptors such as @hourly.
+var cronParser = cron.NewParser(
+	cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor,
+)
+
+// defaultSchedulesFile is read from the working directory, which is the
+// function's task root on Lambda.
+const defaultSchedulesFile = "schedules.json"
+
+// defaultSchedule is used when a run names no schedule. It sends the
+// default work items to SQS_QUEUE_URL.
+var defaultSchedule = &Schedule{Name: "default"}
+
+var (
+	schedulesOnce   sync.Once
+	schedulesConfig *ScheduleConfig
+	schedulesErr    error
+)
+
+// ScheduleConfig is the schedules file named by SCHEDULES_CONFIG_FILE,
+// shared by the Lambda and the scheduler daemon.
+type ScheduleConfig struct {
+	Schedules []Schedule `json:"schedules"`
+}
+
+// Schedule is a named set of work, run by name from an EventBridge rule or
+// on its cron expression by the scheduler daemon. Its work comes from
+// WorkItems, or from WorkItemsFile, which is read again on every run; with
+// neither set the default work items are sent. QueueURL routes the run to
+// a queue other than SQS_QUEUE_URL (the producer must be allowed to send
+// to it), and MaxItems fails runs that resolve more work items than
+// expected. Calendar rules can skip runs the expression alone would allow.
+type Schedule struct {
+	Name            string         `json:"name"`
+	Cron            string         `json:"cron,omitempty"`
+	JitterSeconds   int            `json:"jitterSeconds,omitempty"`
+	MissedRunPolicy string         `json:"missedRunPolicy,omitempty"`
+	WorkItems       []WorkItem     `json:"workItems,omitempty"`
+	WorkItemsFile   string         `json:"workItemsFile,omitempty"`
+	QueueURL        string         `json:"queueUrl,omitempty"`
+	MaxItems        int            `json:"maxItems,omitempty"`
+	Calendar        *CalendarRules `json:"calendar,omitempty"`
+
+	spec cron.Schedule
+}
+
+func schedulesConfigPath() string {
+	if path := os.Getenv("SCHEDULES_CONFIG_FILE"); path != "" {
+		return path
+	}
+	return defaultSchedulesFile
+}
+
+// findSchedule looks up a named schedule. The schedules file is read once
+// per execution environment.
+func findSchedule(name string) (*Schedule, error) {
+	schedulesOnce.Do(func() {
+		schedulesConfig, schedulesErr = loadScheduleConfig(schedulesConfigPath())
+	})
+	if schedulesErr != nil {
+		return nil, schedulesErr
+	}
+
+	for i := range schedulesConfig.Schedules {
+		if schedulesConfig.Schedules[i].Name == name {
+			return &schedulesConfig.Schedules[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown schedule %q", name)
+}
+
+// loadScheduleConfig reads and validates a scheduler configuration file.
+func loadScheduleConfig(path string) (*ScheduleConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schedule config: %w", err)
+	}
+
+	var config ScheduleConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse schedule config: %w", err)
+	}
+
+	if len(config.Schedules) == 0 {
+		return nil, fmt.Errorf("schedule config %s defines no schedules", path)
+	}
+
+	seen := make(map[string]bool, len(config.Schedules))
+	for i := range config.Schedules {
+		schedule := &config.Schedules[i]
+
+		if schedule.Name == "" {
+			return nil, fmt.Errorf("schedule %d has no name", i+1)
+		}
+		if seen[schedule.Name] {
+			return nil, fmt.Errorf("duplicate schedule name %q", schedule.Name)
+		}
+		seen[schedule.Name] = true
+
+		if schedule.Calendar != nil {
+			if err := schedule.Calendar.validate(); err != nil {
+				return nil, fmt.Errorf("schedule %q has invalid calendar rules: %w", schedule.Name, err)
+			}
+		}
+
+		if schedule.Cron != "" {
+			// The daemon evaluates cron expressions in the calendar's
+			// timezone unless the expression names its own
+			expression := schedule.Cron
+			if schedule.Calendar != nil && schedule.Calendar.Timezone != "" &&
+				!strings.HasPrefix(expression, "CRON_TZ=") && !strings.HasPrefix(expression, "TZ=") {
+				expression = "CRON_TZ=" + schedule.Calendar.Timezone + " " + expression
+			}
+
+			spec, err := cronParser.Parse(expression)
+			if err != nil {
+				return nil, fmt.Errorf("schedule %q has an invalid cron expression: %w", schedule.Name, err)
+			}
+			schedule.spec = spec
+		}
+
+		switch schedule.MissedRunPolicy {
+		case "":
+			schedule.MissedRunPolicy = missedRunSkip
+		case missedRunSkip, missedRunRunOnce:
+		default:
+			return nil, fmt.Errorf("schedule %q has unknown missedRunPolicy %q", schedule.Name, schedule.MissedRunPolicy)
+		}
+
+		if schedule.JitterSeconds < 0 {
+			return nil, fmt.Errorf("schedule %q has a negative jitterSeconds", schedule.Name)
+		}
+		if schedule.MaxItems < 0 {
+			return nil, fmt.Errorf("schedule %q has a negative maxItems", schedule.Name)
+		}
+		if len(schedule.WorkItems) > 0 && schedule.WorkItemsFile != "" {
+			return nil, fmt.Errorf("schedule %q sets both workItems and workItemsFile", schedule.Name)
+		}
+	}
+
+	return &config, nil
+}
+
+// jitter is the most a run may be delayed past its scheduled time.
+func (s *Schedule) jitter() time.Duration {
+	return time.Duration(s.JitterSeconds) * time.Second
+}
+
+// resolveWorkItems returns a fresh copy of the schedule's work items, since
+// dispatch stamps run and correlation IDs onto them.
+func (s *Schedule) resolveWorkItems() ([]WorkItem, error) {
+	if s.WorkItemsFile != "" {
+		data, err := os.ReadFile(s.WorkItemsFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read work items for schedule %q: %w", s.Name, err)
+		}
+
+		var workItems []WorkItem
+		if err := json.Unmarshal(data, &workItems); err != nil {
+			return nil, fmt.Errorf("failed to parse work items for schedule %q: %w", s.Name, err)
+		}
+		return workItems, nil
+	}
+
+	if len(s.WorkItems) == 0 {
+		return defaultWorkItems(), nil
+	}
+
+	data, err := json.Marshal(s.WorkItems)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy work items for schedule %q: %w", s.Name, err)
+	}
+
+	var workItems []WorkItem
+	if err := json.Unmarshal(data, &workItems); err != nil {
+		return nil, fmt.Errorf("failed to copy work items for schedule %q: %w", s.Name, err)
+	}
+	return workItems, nil
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"lambda-cron-go-service/internal/telemetry"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 100
+)
+
+type WorkItemStatus struct {
+	RunId         string             `json:"runId" dynamodbav:"runId"`
+	WorkId        int                `json:"workId" dynamodbav:"workId"`
+	WorkType      string             `json:"workType" dynamodbav:"workType"`
+	Status        string             `json:"status" dynamodbav:"status"`
+	MessageId     string             `json:"messageId,omitempty" dynamodbav:"messageId"`
+	CorrelationId string             `json:"correlationId,omitempty" dynamodbav:"correlationId"`
+	Attempts      int                `json:"attempts,omitempty" dynamodbav:"attempts"`
+	LastError     string             `json:"lastError,omitempty" dynamodbav:"lastError"`
+	DependsOn     []int              `json:"dependsOn,omitempty" dynamodbav:"dependsOn"`
+	ParentWorkId  int                `json:"parentWorkId,omitempty" dynamodbav:"parentWorkId"`
+	ChildWorkIds  []int              `json:"childWorkIds,omitempty" dynamodbav:"childWorkIds"`
+	CreatedAt     string             `json:"createdAt" dynamodbav:"createdAt"`
+	UpdatedAt     string             `json:"updatedAt" dynamodbav:"updatedAt"`
+	Transitions   []StatusTransition `json:"transitions" dynamodbav:"transitions"`
+}
+
+type StatusTransition struct {
+	Status  string `json:"status" dynamodbav:"status"`
+	At      string `json:"at" dynamodbav:"at"`
+	Attempt int    `json:"attempt,omitempty" dynamodbav:"attempt"`
+	Error   string `json:"error,omitempty" dynamodbav:"error"`
+}
+
+type ListResponse struct {
+	Items     []WorkItemStatus `json:"items"`
+	NextToken *string          `json:"nextToken"`
+}
+
+type RunSummary struct {
+	RunId  string         `json:"runId"`
+	State  string         `json:"state"`
+	Total  int            `json:"total"`
+	Counts map[string]int `json:"counts"`
+}
+
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+var (
+	dynamoClient *dynamodb.Client
+	tableName    string
+)
+
+// Handler serves read-only lookups of work item status through a Lambda
+// function URL:
+//
+//	GET /runs/{runId}                 all items of a run
+//	GET /runs/{runId}/summary         item counts by status and overall run state
+//	GET /runs/{runId}/items/{workId}  one item of a run
+//	GET /items/{workId}               a work ID across runs, newest first
+//	GET /items?type=...&status=...    items of a type in a status, newest first
+//
+// List endpoints accept limit and nextToken query parameters.
+func Handler(ctx context.Context, request events.LambdaFunctionURLRequest) (events.LambdaFunctionURLResponse, error) {
+	method := request.RequestContext.HTTP.Method
+	path := strings.Trim(request.RawPath, "/")
+	slog.InfoContext(ctx, "Status API request", "method", method, "path", "/"+path)
+
+	if method != http.MethodGet {
+		return jsonResponse(http.StatusMethodNotAllowed, ErrorResponse{Error: "only GET is supported"}), nil
+	}
+
+	segments := strings.Split(path, "/")
+	params := request.QueryStringParameters
+
+	switch {
+	case len(segments) == 2 && segments[0] == "runs":
+		return listByRun(ctx, segments[1], params), nil
+	case len(segments) == 3 && segments[0] == "runs" && segments[2] == "summary":
+		return summarizeRun(ctx, segments[1]), nil
+	case len(segments) == 4 && segments[0] == "runs" && segments[2] == "items":
+		return getItem(ctx, segments[1], segments[3]), nil
+	case len(segments) == 2 && segments[0] == "items":
+		return listByWorkId(ctx, segments[1], params), nil
+	case len(segments) == 1 && segments[0] == "items":
+		return listByTypeAndStatus(ctx, params), nil
+	default:
+		return jsonResponse(http.StatusNotFound, ErrorResponse{Error: "not found"}), nil
+	}
+}
+
+func getItem(ctx context.Context, runId string, workIdParam string) events.LambdaFunctionURLResponse {
+	workId, err := strconv.Atoi(workIdParam)
+	if err != nil {
+		return jsonResponse(http.StatusBadRequest, ErrorResponse{Error: "workId must be a number"})
+	}
+
+	result, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]types.AttributeValue{
+			"runId":  &types.AttributeValueMemberS{Value: runId},
+			"workId": &types.AttributeValueMemberN{Value: strconv.Itoa(workId)},
+		},
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to get work item", "run_id", runId, "work_id", workId, "error", err)
+		return jsonResponse(http.StatusInternalServerError, ErrorResponse{Error: "failed to read status"})
+	}
+	if result.Item == nil {
+		return jsonResponse(http.StatusNotFound, ErrorResponse{Error: "work item not found"})
+	}
+
+	var item WorkItemStatus
+	if err := attributevalue.UnmarshalMap(result.Item, &item); err != nil {
+		slog.ErrorContext(ctx, "Failed to decode work item", "run_id", runId, "work_id", workId, "error", err)
+		return jsonResponse(http.StatusInternalServerError, ErrorResponse{Error: "failed to read status"})
+	}
+
+	return jsonResponse(http.StatusOK, item)
+}
+
+func listByRun(ctx context.Context, runId string, params map[string]string) events.LambdaFunctionURLResponse {
+	return query(ctx, params, &dynamodb.QueryInput{
+		KeyConditionExpression: aws.String("runId = :runId"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":runId": &types.AttributeValueMemberS{Value: runId},
+		},
+	})
+}
+
+// summarizeRun aggregates every item of a run. A run is running while any
+// item can still make progress, failed once it has settled with any item
+// that did not succeed, and succeeded otherwise.
+func summarizeRun(ctx context.Context, runId string) events.LambdaFunctionURLResponse {
+	counts := map[string]int{}
+	total := 0
+
+	paginator := dynamodb.NewQueryPaginator(dynamoClient, &dynamodb.QueryInput{
+		TableName:              aws.String(tableName),
+		KeyConditionExpression: aws.String("runId = :runId"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":runId": &types.AttributeValueMemberS{Value: runId},
+		},
+		ProjectionExpression:     aws.String("#status"),
+		ExpressionAttributeNames: map[string]string{"#status": "status"},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to query run", "run_id", runId, "error", err)
+			return jsonResponse(http.StatusInternalServerError, ErrorResponse{Error: "failed to read status"})
+		}
+
+		for _, item := range page.Items {
+			if status, ok := item["status"].(*types.AttributeValueMemberS); ok {
+				counts[status.Value]++
+				total++
+			}
+		}
+	}
+
+	if total == 0 {
+		return jsonResponse(http.StatusNotFound, ErrorResponse{Error: "run not found"})
+	}
+
+	state := "succeeded"
+	switch {
+	case counts["pending"]+counts["queued"]+counts["in_progress"]+counts["running"]+counts["retrying"] > 0:
+		state = "running"
+	case counts["failed"]+counts["dead_lettered"]+counts["skipped"] > 0:
+		state = "failed"
+	}
+
+	return jsonResponse(http.StatusOK, RunSummary{RunId: runId, State: state, Total: total, Counts: counts})
+}
+
+func listByWorkId(ctx context.Context, workIdParam string, params map[string]string) events.LambdaFunctionURLResponse {
+	workId, err := strconv.Atoi(workIdParam)
+	if err != nil {
+		return jsonResponse(http.StatusBadRequest, ErrorResponse{Error: "workId must be a number"})
+	}
+
+	return query(ctx, params, &dynamodb.QueryInput{
+		IndexName:              aws.String("workId-index"),
+		KeyConditionExpression: aws.String("workId = :workId"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":workId": &types.AttributeValueMemberN{Value: strconv.Itoa(workId)},
+		},
+		ScanIndexForward: aws.Bool(false),
+	})
+}
+
+func listByTypeAndStatus(ctx context.Context, params map[string]string) events.LambdaFunctionURLResponse {
+	workType := params["type"]
+	status := params["status"]
+	if workType == "" || status == "" {
+		return jsonResponse(http.StatusBadRequest, ErrorResponse{Error: "type and status query parameters are required"})
+	}
+
+	return query(ctx, params, &dynamodb.QueryInput{
+		IndexName:              aws.String("typeStatus-index"),
+		KeyConditionExpression: aws.String("typeStatus = :typeStatus"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":typeStatus": &types.AttributeValueMemberS{Value: workType + "#" + status},
+		},
+		ScanIndexForward: aws.Bool(false),
+	})
+}
+
+// query runs a paginated query. The DynamoDB LastEvaluatedKey is handed to
+// callers as an opaque nextToken.
+func query(ctx context.Context, params map[string]string, input *dynamodb.QueryInput) events.LambdaFunctionURLResponse {
+	limit := defaultPageSize
+	if value, ok := params["limit"]; ok {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxPageSize {
+			return jsonResponse(http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("limit must be between 1 and %d", maxPageSize)})
+		}
+		limit = parsed
+	}
+
+	if token := params["nextToken"]; token != "" {
+		startKey, err := decodeNextToken(token)
+		if err != nil {
+			return jsonResponse(http.StatusBadRequest, ErrorResponse{Error: "invalid nextToken"})
+		}
+		input.ExclusiveStartKey = startKey
+	}
+
+	input.TableName = aws.String(tableName)
+	input.Limit = aws.Int32(int32(limit))
+
+	result, err := dynamoClient.Query(ctx, input)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to query work item status", "error", err)
+		return jsonResponse(http.StatusInternalServerError, ErrorResponse{Error: "failed to read status"})
+	}
+
+	items := []WorkItemStatus{}
+	if err := attributevalue.UnmarshalListOfMaps(result.Items, &items); err != nil {
+		slog.ErrorContext(ctx, "Failed to decode work item status", "error", err)
+		return jsonResponse(http.StatusInternalServerError, ErrorResponse{Error: "failed to read status"})
+	}
+
+	response := ListResponse{Items: items}
+	if len(result.LastEvaluatedKey) > 0 {
+		token, err := encodeNextToken(result.LastEvaluatedKey)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to encode nextToken", "error", err)
+			return jsonResponse(http.StatusInternalServerError, ErrorResponse{Error: "failed to read status"})
+		}
+		response.NextToken = &token
+	}
+
+	return jsonResponse(http.StatusOK, response)
+}
+
+func encodeNextToken(key map[string]types.AttributeValue) (string, error) {
+	var plain map[string]interface{}
+	if err := attributevalue.UnmarshalMap(key, &plain); err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(plain)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeNextToken(token string) (map[string]types.AttributeValue, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, err
+	}
+
+	var plain map[string]interface{}
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&plain); err != nil {
+		return nil, err
+	}
+
+	// Numeric key attributes (workId) must go back to DynamoDB as numbers
+	key := make(map[string]types.AttributeValue, len(plain))
+	for name, value := range plain {
+		switch v := value.(type) {
+		case json.Number:
+			key[name] = &types.AttributeValueMemberN{Value: v.String()}
+		case string:
+			key[name] = &types.AttributeValueMemberS{Value: v}
+		default:
+			return nil, fmt.Errorf("unsupported key attribute %s", name)
+		}
+	}
+
+	return key, nil
+}
+
+func jsonResponse(statusCode int, body interface{}) events.LambdaFunctionURLResponse {
+	data, err := json.Marshal(body)
+	if err != nil {
+		slog.Error("Failed to marshal response", "error", err)
+		statusCode = http.StatusInternalServerError
+		data = []byte(`{"error":"internal error"}`)
+	}
+
+	return events.LambdaFunctionURLResponse{
+		StatusCode: statusCode,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(data),
+	}
+}
+
+func main() {
+	telemetry.Init(telemetry.Service{Name: "lambda-cron-go-status-api"})
+
+	tableName = os.Getenv("STATUS_TABLE_NAME")
+	if tableName == "" {
+		slog.Error("STATUS_TABLE_NAME environment variable is not set")
+		os.Exit(1)
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.Background())
+	if err != nil {
+		slog.Error("Failed to load AWS config", "error", err)
+		os.Exit(1)
+	}
+	dynamoClient = dynamodb.NewFromConfig(cfg)
+
+	lambda.Start(Handler)
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	"lambda-cron-go-service/internal/workstatus"
+)
+
+// recordStatus writes a transition for a work item. Status tracking is best
+// effort: failures are logged and never fail the run.
+func recordStatus(ctx context.Context, store *workstatus.Store, item WorkItem, status string, errorMessage *string) {
+	if store == nil {
+		return
+	}
+
+	err := store.Record(ctx, workstatus.Transition{
+		RunId:         item.RunId,
+		WorkId:        item.ID,
+		WorkType:      item.Type,
+		Status:        status,
+		CorrelationId: item.CorrelationId,
+		Error:         errorMessage,
+	})
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to record work item status", "error", err)
+	}
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"lambda-cron-go-service/internal/env"
+	"lambda-cron-go-service/internal/telemetry"
+)
+
+// Circuit breaker states. A closed breaker lets calls through, an open one
+// fails them immediately until the cooldown ends, and a half-open one lets
+// a single trial call through to decide which way to go.
+const (
+	circuitClosed   = "closed"
+	circuitOpen     = "open"
+	circuitHalfOpen = "half_open"
+)
+
+const (
+	defaultCircuitFailureThreshold = 5
+	defaultCircuitCooldown         = 30 * time.Second
+
+	// sharedCircuitRefresh is how often a closed breaker checks the shared
+	// state table for a breaker opened by another execution environment.
+	sharedCircuitRefresh = 5 * time.Second
+)
+
+// errCircuitOpen is returned, wrapped as retryable, for calls rejected by an
+// open breaker.
+var errCircuitOpen = errors.New("circuit breaker is open")
+
+// circuitBreaker tracks the health of one downstream dependency. Breakers
+// live for the execution environment, so their state carries across warm
+// invocations.
+type circuitBreaker struct {
+	mu               sync.Mutex
+	dependency       string
+	state            string
+	failures         int
+	openUntil        time.Time
+	trialInFlight    bool
+	sharedCheckedAt  time.Time
+	failureThreshold int
+	cooldown         time.Duration
+}
+
+var (
+	circuitBreakersMu sync.Mutex
+	circuitBreakers   = map[string]*circuitBreaker{}
+)
+
+// withCircuitBreaker runs call through the breaker for dependency. Only
+// retryable errors count as failures of the dependency; a permanent error
+// means it answered. While the breaker is open call is not run and a
+// retryable error is returned straight away.
+//
+// Metrics sinks buffer what they record and never hold up a work item; the
+// InfluxDB writes they make when flushed are guarded through
+// telemetryBreakers instead.
+func withCircuitBreaker(ctx context.Context, dependency string, metrics telemetry.MetricsSink, call func() error) error {
+	breaker := getCircuitBreaker(dependency)
+
+	if !breaker.allow(ctx, metrics) {
+		return retryable(fmt.Errorf("%s unavailable: %w", dependency, errCircuitOpen))
+	}
+
+	err := call()
+	breaker.record(ctx, metrics, !isRetryable(err))
+	return err
+}
+
+func getCircuitBreaker(dependency string) *circuitBreaker {
+	circuitBreakersMu.Lock()
+	defer circuitBreakersMu.Unlock()
+
+	breaker, ok := circuitBreakers[dependency]
+	if !ok {
+		breaker = &circuitBreaker{
+			dependency:       dependency,
+			state:            circuitClosed,
+			failureThreshold: env.Int("CIRCUIT_BREAKER_FAILURE_THRESHOLD", defaultCircuitFailureThreshold),
+			cooldown:         time.Duration(env.Int("CIRCUIT_BREAKER_COOLDOWN_SECONDS", int(defaultCircuitCooldown.Seconds()))) * time.Second,
+		}
+		circuitBreakers[dependency] = breaker
+	}
+
+	return breaker
+}
+
+// telemetryBreakers runs telemetry's calls to its dependencies, such as
+// InfluxDB, through the worker's circuit breakers.
+type telemetryBreakers struct{}
+
+func (telemetryBreakers) Allow(ctx context.Context, dependency string, metrics telemetry.MetricsSink) bool {
+	return getCircuitBreaker(dependency).allow(ctx, metrics)
+}
+
+func (telemetryBreakers) Record(ctx context.Context, dependency string, metrics telemetry.MetricsSink, healthy bool) {
+	getCircuitBreaker(dependency).record(ctx, metrics, healthy)
+}
+
+func (b *circuitBreaker) allow(ctx context.Context, metrics telemetry.MetricsSink) bool {
+	b.refreshShared(ctx, metrics)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	switch b.state {
+	case circuitOpen:
+		if now.Before(b.openUntil) {
+			return false
+		}
+		b.transition(metrics, circuitHalfOpen, "local")
+		b.trialInFlight = true
+		return true
+	case circuitHalfOpen:
+		if b.trialInFlight {
+			return false
+		}
+		b.trialInFlight = true
+		return true
+	default:
+		return true
+	}
+}
+
+// refreshShared picks up a breaker opened elsewhere so this environment
+// does not have to find out the slow way. The table is read without holding
+// b.mu, so other calls are not held up behind it.
+func (b *circuitBreaker) refreshShared(ctx context.Context, metrics telemetry.MetricsSink) {
+	if sharedCircuitTable() == "" {
+		return
+	}
+
+	b.mu.Lock()
+	due := b.state == circuitClosed && time.Since(b.sharedCheckedAt) >= sharedCircuitRefresh
+	if due {
+		b.sharedCheckedAt = time.Now()
+	}
+	b.mu.Unlock()
+
+	if !due {
+		return
+	}
+
+	openUntil, err := loadSharedCircuit(ctx, b.dependency)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to load shared circuit breaker state", "dependency", b.dependency, "error", err)
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == circuitClosed && openUntil.After(time.Now()) {
+		b.openUntil = openUntil
+		b.transition(metrics, circuitOpen, "shared")
+	}
+}
+
+func (b *circuitBreaker) record(ctx context.Context, metrics telemetry.MetricsSink, success bool) {
+	b.mu.Lock()
+	b.trialInFlight = false
+
+	share := ""
+	if success {
+		b.failures = 0
+		if b.state != circuitClosed {
+			b.transition(metrics, circuitClosed, "local")
+			share = circuitClosed
+		}
+	} else {
+		b.failures++
+		if b.state == circuitHalfOpen || (b.state == circuitClosed && b.failures >= b.failureThreshold) {
+			b.openUntil = time.Now().Add(b.cooldown)
+			b.transition(metrics, circuitOpen, "local")
+			share = circuitOpen
+		}
+	}
+	openUntil := b.openUntil
+	b.mu.Unlock()
+
+	// Shared outside the lock, like refreshShared's read
+	switch share {
+	case circuitClosed:
+		saveSharedCircuit(ctx, b.dependency, circuitClosed, time.Time{})
+	case circuitOpen:
+		saveSharedCircuit(ctx, b.dependency, circuitOpen, openUntil)
+	}
+}
+
+// transition changes state and records the change. Callers hold b.mu.
+func (b *circuitBreaker) transition(metrics telemetry.MetricsSink, state string, source string) {
+	slog.Warn("Circuit breaker changed state",
+		"dependency", b.dependency,
+		"from", b.state,
+		"to", state,
+		"source", source,
+		"consecutive_failures", b.failures)
+	b.state = state
+
+	// Record breaker state change
+	fields := telemetry.Fields{
+		"consecutive_failures": b.failures,
+	}
+
+	if state == circuitOpen {
+		fields["open_seconds"] = time.Until(b.openUntil).Seconds()
+	}
+
+	metrics.Event("circuit_breaker", telemetry.Tags{
+		"dependency": b.dependency,
+		"state":      state,
+		"source":     source,
+	}, fields)
+}
+
+// sharedCircuitTable names the optional DynamoDB table, keyed by
+// dependency, through which execution environments share open breakers.
+func sharedCircuitTable() string {
+	return os.Getenv("CIRCUIT_BREAKER_TABLE_NAME")
+}
+
+func loadSharedCircuit(ctx context.Context, dependency string) (time.Time, error) {
+	cfg, err := telemetry.GetAWSConfig(ctx)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	result, err := dynamodb.NewFromConfig(cfg).GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(sharedCircuitTable()),
+		Key: map[string]ddbtypes.AttributeValue{
+			"dependency": &ddbtypes.AttributeValueMemberS{Value: dependency},
+		},
+	})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read shared circuit breaker state for %s: %w", dependency, err)
+	}
+
+	state, _ := result.Item["state"].(*ddbtypes.AttributeValueMemberS)
+	openUntil, _ := result.Item["openUntil"].(*ddbtypes.AttributeValueMemberN)
+	if state == nil || state.Value != circuitOpen || openUntil == nil {
+		return time.Time{}, nil
+	}
+
+	millis, err := strconv.ParseInt(openUntil.Value, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid shared circuit breaker state for %s: %w", dependency, err)
+	}
+
+	return time.UnixMilli(millis), nil
+}
+
+// saveSharedCircuit publishes a breaker state change. It is best effort:
+// failures are logged and the local breaker carries on regardless.
+func saveSharedCircuit(ctx context.Context, dependency string, state string, openUntil time.Time) {
+	if sharedCircuitTable() == "" {
+		return
+	}
+
+	cfg, err := telemetry.GetAWSConfig(ctx)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to load AWS config", "error", err)
+		return
+	}
+
+	now := time.Now()
+	_, err = dynamodb.NewFromConfig(cfg).PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(sharedCircuitTable()),
+		Item: map[string]ddbtypes.AttributeValue{
+			"dependency": &ddbtypes.AttributeValueMemberS{Value: dependency},
+			"state":      &ddbtypes.AttributeValueMemberS{Value: state},
+			"openUntil":  &ddbtypes.AttributeValueMemberN{Value: strconv.FormatInt(openUntil.UnixMilli(), 10)},
+			"updatedAt":  &ddbtypes.AttributeValueMemberS{Value: now.UTC().Format(time.RFC3339Nano)},
+			"expiresAt":  &ddbtypes.AttributeValueMemberN{Value: strconv.FormatInt(now.Add(24*time.Hour).Unix(), 10)},
+		},
+	})
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to share circuit breaker state", "dependency", dependency, "error", err)
+	}
+}
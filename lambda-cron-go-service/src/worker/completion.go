@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	ebtypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+
+	"lambda-cron-go-service/internal/workstatus"
+)
+
+const completionEventSource = "lambda-cron-go-worker"
+
+// WorkResult holds references to what a processor produced, such as the S3
+// key of a generated report. It is carried in completion events.
+type WorkResult map[string]interface{}
+
+// CompletionEvent is published once a work item has succeeded, failed
+// permanently or failed its last attempt before SQS moves it to the dead
+// letter queue. Other retryable failures are not published since the item
+// will be processed again.
+type CompletionEvent struct {
+	WorkId        int        `json:"workId"`
+	Type          string     `json:"type"`
+	Outcome       string     `json:"outcome"`
+	DurationMs    int64      `json:"durationMs"`
+	Error         *string    `json:"error,omitempty"`
+	Results       WorkResult `json:"results,omitempty"`
+	CorrelationId string     `json:"correlationId"`
+	MessageId     string     `json:"messageId"`
+	Environment   string     `json:"environment"`
+	Timestamp     string     `json:"timestamp"`
+}
+
+// completionPublisher delivers completion events to a downstream target.
+type completionPublisher interface {
+	Publish(ctx context.Context, event CompletionEvent) error
+}
+
+// newCompletionPublisher builds the publisher selected by
+// COMPLETION_EVENT_TARGET ("eventbridge", "sns" or "none"). It returns nil
+// when publishing is disabled.
+func newCompletionPublisher(cfg aws.Config) (completionPublisher, error) {
+	switch target := os.Getenv("COMPLETION_EVENT_TARGET"); target {
+	case "", "none":
+		return nil, nil
+	case "eventbridge":
+		busName := os.Getenv("COMPLETION_EVENT_BUS_NAME")
+		if busName == "" {
+			busName = "default"
+		}
+		return &eventBridgePublisher{client: eventbridge.NewFromConfig(cfg), busName: busName}, nil
+	case "sns":
+		topicArn := os.Getenv("COMPLETION_EVENT_TOPIC_ARN")
+		if topicArn == "" {
+			return nil, fmt.Errorf("COMPLETION_EVENT_TOPIC_ARN environment variable is not set")
+		}
+		return &snsPublisher{client: sns.NewFromConfig(cfg), topicArn: topicArn}, nil
+	default:
+		return nil, fmt.Errorf("unknown COMPLETION_EVENT_TARGET: %s", target)
+	}
+}
+
+type eventBridgePublisher struct {
+	client  *eventbridge.Client
+	busName string
+}
+
+func (p *eventBridgePublisher) Publish(ctx context.Context, event CompletionEvent) error {
+	detail, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal completion event: %w", err)
+	}
+
+	detailType := "Work Item Succeeded"
+	if event.Outcome != "succeeded" {
+		detailType = "Work Item Failed"
+	}
+
+	result, err := p.client.PutEvents(ctx, &eventbridge.PutEventsInput{
+		Entries: []ebtypes.PutEventsRequestEntry{
+			{
+				EventBusName: aws.String(p.busName),
+				Source:       aws.String(completionEventSource),
+				DetailType:   aws.String(detailType),
+				Detail:       aws.String(string(detail)),
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put completion event: %w", err)
+	}
+	if result.FailedEntryCount > 0 && len(result.Entries) > 0 {
+		entry := result.Entries[0]
+		return fmt.Errorf("completion event rejected: %s: %s", aws.ToString(entry.ErrorCode), aws.ToString(entry.ErrorMessage))
+	}
+
+	return nil
+}
+
+type snsPublisher struct {
+	client   *sns.Client
+	topicArn string
+}
+
+func (p *snsPublisher) Publish(ctx context.Context, event CompletionEvent) error {
+	message, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal completion event: %w", err)
+	}
+
+	// Attributes allow subscribers to filter without parsing the message
+	_, err = p.client.Publish(ctx, &sns.PublishInput{
+		TopicArn: aws.String(p.topicArn),
+		Message:  aws.String(string(message)),
+		MessageAttributes: map[string]snstypes.MessageAttributeValue{
+			"source": {
+				DataType:    aws.String("String"),
+				StringValue: aws.String(completionEventSource),
+			},
+			"workType": {
+				DataType:    aws.String("String"),
+				StringValue: aws.String(event.Type),
+			},
+			"outcome": {
+				DataType:    aws.String("String"),
+				StringValue: aws.String(event.Outcome),
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish completion event: %w", err)
+	}
+
+	return nil
+}
+
+func publishCompletionEvent(ctx context.Context, publisher completionPublisher, workItem WorkItem, record events.SQSMessage,
+	status string, results WorkResult, errorMessage *string, duration time.Duration, environment string) {
+	outcome := "failed"
+	switch status {
+	case "success":
+		outcome = "succeeded"
+	case "retry":
+		outcome = workstatus.DeadLettered
+	}
+
+	correlationId := workItem.CorrelationId
+	if correlationId == "" {
+		correlationId = record.MessageId
+	}
+
+	event := CompletionEvent{
+		WorkId:        workItem.ID,
+		Type:          workItem.Type,
+		Outcome:       outcome,
+		DurationMs:    duration.Milliseconds(),
+		Error:         errorMessage,
+		Results:       results,
+		CorrelationId: correlationId,
+		MessageId:     record.MessageId,
+		Environment:   environment,
+		Timestamp:     time.Now().UTC().Format(time.RFC3339),
+	}
+
+	// The work itself is done, so a publishing failure is logged rather
+	// than failing the item
+	if err := publisher.Publish(ctx, event); err != nil {
+		slog.WarnContext(ctx, "Failed to publish completion event", "error", err)
+		return
+	}
+
+	slog.InfoContext(ctx, "Published completion event", "outcome", outcome)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"lambda-cron-go-service/internal/telemetry"
+)
+
+// dataAction handles one data_processing action. Returned errors are
+// permanent unless wrapped with retryable.
+type dataAction func(ctx context.Context, payload map[string]interface{}, metrics telemetry.MetricsSink) (WorkResult, error)
+
+// dataActions is the registry of supported data_processing actions, keyed by
+// the payload "action" value.
+var dataActions = map[string]dataAction{
+	"update_profile": updateProfile,
+}
+
+// profileColumns maps the profile fields accepted in an update_profile
+// payload to their columns in the users table. Only these fields can be
+// updated.
+var profileColumns = map[string]string{
+	"displayName": "display_name",
+	"email":       "email",
+	"phone":       "phone",
+	"locale":      "locale",
+	"timezone":    "timezone",
+}
+
+var errVersionConflict = errors.New("profile version conflict")
+
+// updateProfile applies a partial profile update to the users table. With
+// an expectedVersion in the payload the update only succeeds if the row is
+// still at the version the sender read, so a concurrent writer causes a
+// permanent conflict rather than a lost update; without one the update is
+// applied unconditionally. migrations/001_users_profile.sql creates the
+// columns it relies on.
+func updateProfile(ctx context.Context, payload map[string]interface{}, metrics telemetry.MetricsSink) (WorkResult, error) {
+	startTime := time.Now()
+
+	userIdFloat, ok := payload["userId"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("missing or invalid userId in payload")
+	}
+	userId := int(userIdFloat)
+
+	expectedVersion := 0
+	if value, present := payload["expectedVersion"]; present {
+		versionFloat, ok := value.(float64)
+		if !ok || versionFloat < 1 {
+			return nil, fmt.Errorf("invalid expectedVersion in payload")
+		}
+		expectedVersion = int(versionFloat)
+	}
+
+	profile, ok := payload["profile"].(map[string]interface{})
+	if !ok || len(profile) == 0 {
+		return nil, fmt.Errorf("missing or empty profile in payload")
+	}
+
+	fields := make([]string, 0, len(profile))
+	for field, value := range profile {
+		if _, ok := profileColumns[field]; !ok {
+			return nil, fmt.Errorf("unsupported profile field: %s", field)
+		}
+		if _, ok := value.(string); !ok && value != nil {
+			return nil, fmt.Errorf("invalid value for profile field %s", field)
+		}
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	var newVersion int
+	err := withCircuitBreaker(ctx, "postgres", metrics, func() error {
+		var err error
+		newVersion, err = applyProfileUpdate(ctx, userId, expectedVersion, fields, profile)
+		return err
+	})
+
+	status := "updated"
+	switch {
+	case err == nil:
+		slog.InfoContext(ctx, "Updated profile", "user_id", userId, "version", newVersion, "fields", fields)
+	case errors.Is(err, errVersionConflict):
+		status = "conflict"
+		err = fmt.Errorf("user %d: %w", userId, err)
+	case errors.Is(err, errCircuitOpen):
+		status = "circuit_open"
+	case errors.Is(err, pgx.ErrNoRows):
+		status = "not_found"
+		err = fmt.Errorf("user %d not found", userId)
+	default:
+		status = "error"
+	}
+
+	// Record user activity
+	activity := telemetry.Fields{
+		"user_ref":           userId,
+		"fields_updated":     len(fields),
+		"processing_time_ms": time.Since(startTime).Milliseconds(),
+	}
+
+	if status == "updated" {
+		activity["version"] = newVersion
+	}
+
+	metrics.Event("user_activity", telemetry.Tags{
+		"action": "update_profile",
+		"status": status,
+	}, activity)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return WorkResult{"userId": userId, "version": newVersion}, nil
+}
+
+// applyProfileUpdate writes the profile fields and bumps the row's version,
+// returning the new one. An expectedVersion of zero skips the version check.
+func applyProfileUpdate(ctx context.Context, userId int, expectedVersion int, fields []string, profile map[string]interface{}) (int, error) {
+	db, err := getDatabase(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	assignments := make([]string, 0, len(fields))
+	args := make([]interface{}, 0, len(fields)+2)
+	for _, field := range fields {
+		args = append(args, profile[field])
+		assignments = append(assignments, fmt.Sprintf("%s = $%d", profileColumns[field], len(args)))
+	}
+	args = append(args, userId)
+
+	query := fmt.Sprintf(
+		"UPDATE users SET %s, version = version + 1, updated_at = now() WHERE id = $%d",
+		strings.Join(assignments, ", "), len(args),
+	)
+	if expectedVersion > 0 {
+		args = append(args, expectedVersion)
+		query += fmt.Sprintf(" AND version = $%d", len(args))
+	}
+	query += " RETURNING version"
+
+	var version int
+	err = db.QueryRow(ctx, query, args...).Scan(&version)
+	if err == nil {
+		return version, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		resetDatabaseOnAuthError(ctx, err)
+		return 0, retryable(fmt.Errorf("failed to update user %d: %w", userId, err))
+	}
+	if expectedVersion == 0 {
+		return 0, err
+	}
+
+	// Nothing matched: the user is gone, or its version moved on
+	if err := db.QueryRow(ctx, "SELECT version FROM users WHERE id = $1", userId).Scan(&version); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, err
+		}
+		resetDatabaseOnAuthError(ctx, err)
+		return 0, retryable(fmt.Errorf("failed to read user %d: %w", userId, err))
+	}
+
+	return 0, fmt.Errorf("%w: expected version %d, found %d", errVersionConflict, expectedVersion, version)
+}
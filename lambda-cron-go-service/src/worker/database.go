@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"lambda-cron-go-service/internal/telemetry"
+)
+
+// DatabaseCredentials mirrors the secret written by the infrastructure rds
+// module.
+type DatabaseCredentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	DBName   string `json:"dbname"`
+}
+
+// invalidPasswordCode is the SQLSTATE Postgres fails authentication with,
+// as it does once the password in the secret has been rotated.
+const invalidPasswordCode = "28P01"
+
+var (
+	dbPoolMu sync.Mutex
+	dbPool   *pgxpool.Pool
+	// dbPoolSecret is the secret value dbPool was built from
+	dbPoolSecret string
+)
+
+// getDatabase returns the Postgres pool for this execution environment,
+// creating it on first use so warm invocations reuse open connections.
+// The secret is read through the secret cache on every call, and when it
+// has changed, because the credentials were rotated, the pool is rebuilt
+// with the new ones.
+func getDatabase(ctx context.Context) (*pgxpool.Pool, error) {
+	dbPoolMu.Lock()
+	defer dbPoolMu.Unlock()
+
+	secretArn := os.Getenv("DATABASE_SECRET_ARN")
+	if secretArn == "" {
+		return nil, fmt.Errorf("DATABASE_SECRET_ARN environment variable is not set")
+	}
+
+	secret, err := telemetry.GetSecret(ctx, secretArn)
+	if err != nil {
+		if dbPool != nil {
+			slog.WarnContext(ctx, "Failed to refresh the database secret, keeping the open pool", "error", err)
+			return dbPool, nil
+		}
+		return nil, retryable(fmt.Errorf("failed to retrieve database secret: %w", err))
+	}
+
+	if dbPool != nil {
+		if secret == dbPoolSecret {
+			return dbPool, nil
+		}
+		slog.InfoContext(ctx, "Database secret changed, reconnecting")
+		closeDatabase()
+	}
+
+	var credentials DatabaseCredentials
+	if err := json.Unmarshal([]byte(secret), &credentials); err != nil {
+		return nil, fmt.Errorf("failed to parse database credentials: %w", err)
+	}
+
+	port := credentials.Port
+	if port == 0 {
+		port = 5432
+	}
+
+	connURL := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(credentials.Username, credentials.Password),
+		Host:     credentials.Host + ":" + strconv.Itoa(port),
+		Path:     "/" + credentials.DBName,
+		RawQuery: "sslmode=require",
+	}
+
+	poolConfig, err := pgxpool.ParseConfig(connURL.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse database config: %w", err)
+	}
+	// A Lambda execution environment handles one batch at a time
+	poolConfig.MaxConns = 2
+	poolConfig.ConnConfig.Tracer = queryTracer{}
+
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		return nil, retryable(fmt.Errorf("failed to connect to database: %w", err))
+	}
+
+	dbPool, dbPoolSecret = pool, secret
+	return dbPool, nil
+}
+
+// resetDatabaseOnAuthError drops the pool and the cached secret when err
+// is Postgres rejecting the password, so the next getDatabase re-reads the
+// secret and reconnects with the rotated credentials.
+func resetDatabaseOnAuthError(ctx context.Context, err error) {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != invalidPasswordCode {
+		return
+	}
+
+	dbPoolMu.Lock()
+	defer dbPoolMu.Unlock()
+
+	slog.WarnContext(ctx, "Database rejected the password, refreshing credentials", "error", err)
+	telemetry.InvalidateSecret(os.Getenv("DATABASE_SECRET_ARN"))
+	closeDatabase()
+}
+
+// closeDatabase discards the pool. Close waits for connections in use to
+// be released, so it runs in the background. The caller must hold
+// dbPoolMu.
+func closeDatabase() {
+	if dbPool == nil {
+		return
+	}
+
+	go dbPool.Close()
+	dbPool, dbPoolSecret = nil, ""
+}
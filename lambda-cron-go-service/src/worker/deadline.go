@@ -0,0 +1,27 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"lambda-cron-go-service/internal/env"
+)
+
+const defaultDrainMargin = 15 * time.Second
+
+// drainMargin is how much of the invocation's time must be left to start
+// another record, from DRAIN_SAFETY_MARGIN_SECONDS. It should cover the
+// slowest work item plus the batch's closing writes.
+func drainMargin() time.Duration {
+	return time.Duration(env.Int("DRAIN_SAFETY_MARGIN_SECONDS", int(defaultDrainMargin.Seconds()))) * time.Second
+}
+
+// nearDeadline reports whether the invocation has less than margin left
+// before Lambda stops it. Contexts without a deadline never drain.
+func nearDeadline(ctx context.Context, margin time.Duration) bool {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return false
+	}
+	return time.Until(deadline) < margin
+}
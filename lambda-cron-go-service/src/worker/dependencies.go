@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"lambda-cron-go-service/internal/workstatus"
+)
+
+// settleDependents updates the items of a run that wait on workItem once it
+// reaches a final status. Success releases dependents whose dependencies
+// have all succeeded by enqueueing them; failure marks every pending
+// descendant as skipped. It is a no-op for items outside a tracked run.
+func settleDependents(ctx context.Context, store *workstatus.Store, workItem WorkItem, finalStatus string) error {
+	if store == nil || workItem.RunId == "" {
+		return nil
+	}
+
+	switch finalStatus {
+	case workstatus.Succeeded:
+		return releaseDependents(ctx, store, workItem)
+	case workstatus.Failed, workstatus.DeadLettered:
+		return skipDescendants(ctx, store, workItem)
+	default:
+		return nil
+	}
+}
+
+func releaseDependents(ctx context.Context, store *workstatus.Store, workItem WorkItem) error {
+	states, err := store.ListRun(ctx, workItem.RunId)
+	if err != nil {
+		return err
+	}
+
+	statusById := make(map[int]string, len(states))
+	for _, state := range states {
+		statusById[state.WorkId] = state.Status
+	}
+	statusById[workItem.ID] = workstatus.Succeeded
+
+	for _, state := range states {
+		if state.Status != workstatus.Pending || !containsWorkId(state.DependsOn, workItem.ID) {
+			continue
+		}
+
+		ready := true
+		for _, dependency := range state.DependsOn {
+			if statusById[dependency] != workstatus.Succeeded {
+				ready = false
+				break
+			}
+		}
+		if !ready {
+			continue
+		}
+
+		var dependent WorkItem
+		if err := json.Unmarshal([]byte(state.Body), &dependent); err != nil {
+			return fmt.Errorf("failed to parse pending work item %d: %w", state.WorkId, err)
+		}
+
+		// Claim the item first so that dependencies finishing at the same
+		// time cannot both enqueue it
+		err := store.Record(ctx, workstatus.Transition{
+			RunId:          dependent.RunId,
+			WorkId:         dependent.ID,
+			WorkType:       dependent.Type,
+			Status:         workstatus.Queued,
+			CorrelationId:  dependent.CorrelationId,
+			ExpectedStatus: workstatus.Pending,
+		})
+		if errors.Is(err, workstatus.ErrChanged) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, err := enqueueWorkItem(ctx, dependent, 0); err != nil {
+			// Hand the item back so the next attempt can release it
+			revertErr := store.Record(ctx, workstatus.Transition{
+				RunId:          dependent.RunId,
+				WorkId:         dependent.ID,
+				WorkType:       dependent.Type,
+				Status:         workstatus.Pending,
+				CorrelationId:  dependent.CorrelationId,
+				ExpectedStatus: workstatus.Queued,
+			})
+			if revertErr != nil {
+				slog.WarnContext(ctx, "Failed to return dependent work item to pending", "dependent_work_id", dependent.ID, "error", revertErr)
+			}
+			return err
+		}
+
+		slog.InfoContext(ctx, "Released dependent work item after its dependencies succeeded", "dependent_work_id", dependent.ID)
+	}
+
+	return nil
+}
+
+func skipDescendants(ctx context.Context, store *workstatus.Store, workItem WorkItem) error {
+	states, err := store.ListRun(ctx, workItem.RunId)
+	if err != nil {
+		return err
+	}
+
+	// Walk outwards from the failed item until no further pending item
+	// depends on anything that did not succeed
+	unsatisfied := map[int]bool{workItem.ID: true}
+	for changed := true; changed; {
+		changed = false
+
+		for _, state := range states {
+			if state.Status != workstatus.Pending || unsatisfied[state.WorkId] {
+				continue
+			}
+
+			var blockedBy int
+			blocked := false
+			for _, dependency := range state.DependsOn {
+				if unsatisfied[dependency] {
+					blockedBy = dependency
+					blocked = true
+					break
+				}
+			}
+			if !blocked {
+				continue
+			}
+
+			unsatisfied[state.WorkId] = true
+			changed = true
+
+			reason := fmt.Sprintf("dependency %d did not succeed", blockedBy)
+			err := store.Record(ctx, workstatus.Transition{
+				RunId:          state.RunId,
+				WorkId:         state.WorkId,
+				WorkType:       state.WorkType,
+				Status:         workstatus.Skipped,
+				Error:          &reason,
+				ExpectedStatus: workstatus.Pending,
+			})
+			if err != nil && !errors.Is(err, workstatus.ErrChanged) {
+				return err
+			}
+
+			slog.InfoContext(ctx, "Skipped dependent work item", "dependent_work_id", state.WorkId, "reason", reason)
+		}
+	}
+
+	return nil
+}
+
+// storedStatus returns the status a tracked work item is recorded in, or an
+// empty string when it is untracked or cannot be read. A succeeded item, or
+// a workflow item already running, means the message is a redelivery.
+func storedStatus(ctx context.Context, store *workstatus.Store, workItem WorkItem) string {
+	if store == nil || workItem.RunId == "" {
+		return ""
+	}
+
+	state, err := store.Get(ctx, workItem.RunId, workItem.ID)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to read work item status", "error", err)
+		return ""
+	}
+	if state == nil {
+		return ""
+	}
+
+	return state.Status
+}
+
+func containsWorkId(ids []int, id int) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,31 @@
+package main
+
+import "errors"
+
+// retryableError marks a work item failure as transient. The message is
+// reported back to SQS as a batch item failure so it is redelivered, and
+// eventually moved to the dead letter queue if it keeps failing. Any other
+// error is treated as permanent and the message is acknowledged.
+type retryableError struct {
+	err error
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryableError) Unwrap() error {
+	return e.err
+}
+
+func retryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &retryableError{err: err}
+}
+
+func isRetryable(err error) bool {
+	var target *retryableError
+	return errors.As(err, &target)
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"time"
+
+	"lambda-cron-go-service/internal/telemetry"
+	"lambda-cron-go-service/internal/workstatus"
+)
+
+const (
+	// childItemsKey is the WorkResult key under which processors collect
+	// child work items. It is removed before results are published.
+	childItemsKey = "childItems"
+
+	// Child work IDs are derived from the parent's as
+	// parentId*childIdFactor + position, so a retried parent produces the
+	// same IDs and status records instead of new ones. Nothing stops another
+	// item of the run from having the same ID, so children are claimed in
+	// the status table before they are sent and a fan-out onto taken IDs
+	// fails.
+	childIdFactor = 1000
+	maxChildItems = childIdFactor - 1
+)
+
+// ChildWorkItem is follow-up work a processor asks for. The worker enqueues
+// it once the parent has been processed successfully, delivered after
+// Delay.
+type ChildWorkItem struct {
+	Type    string
+	Payload map[string]interface{}
+	Delay   time.Duration
+}
+
+// addChild schedules a child work item to be enqueued when the parent
+// succeeds.
+func (r WorkResult) addChild(child ChildWorkItem) {
+	children, _ := r[childItemsKey].([]ChildWorkItem)
+	r[childItemsKey] = append(children, child)
+}
+
+// takeChildren removes and returns the child work items collected in
+// results.
+func takeChildren(results WorkResult) []ChildWorkItem {
+	children, _ := results[childItemsKey].([]ChildWorkItem)
+	delete(results, childItemsKey)
+	return children
+}
+
+// fanOutChildren enqueues a parent's child work items and returns their work
+// IDs. Children inherit the parent's run, so they are tracked in the status
+// table with a link back to the parent, and their correlation IDs extend the
+// parent's. A failed send is retryable: the parent is processed again and
+// the children that were not sent are re-enqueued under the same IDs. A
+// child ID already used by an item that is not this parent's child fails
+// the parent permanently.
+func fanOutChildren(ctx context.Context, store *workstatus.Store, parent WorkItem, children []ChildWorkItem, metrics telemetry.MetricsSink) ([]int, error) {
+	if len(children) > maxChildItems {
+		return nil, fmt.Errorf("work item %d requested %d child work items, at most %d are allowed",
+			parent.ID, len(children), maxChildItems)
+	}
+	if parent.ID <= 0 || parent.ID > (math.MaxInt-maxChildItems)/childIdFactor {
+		return nil, fmt.Errorf("work item %d cannot have child work items, their IDs would be out of range", parent.ID)
+	}
+
+	childIds := make([]int, 0, len(children))
+	queued := make([]queuedWorkItem, 0, len(children))
+	for i, child := range children {
+		item := WorkItem{
+			ID:       parent.ID*childIdFactor + i + 1,
+			Type:     child.Type,
+			Payload:  child.Payload,
+			RunId:    parent.RunId,
+			ParentId: parent.ID,
+		}
+		if parent.CorrelationId != "" {
+			item.CorrelationId = fmt.Sprintf("%s-%d", parent.CorrelationId, i+1)
+		}
+
+		childIds = append(childIds, item.ID)
+		queued = append(queued, queuedWorkItem{Item: item, Delay: child.Delay})
+	}
+
+	// Record children as queued before sending so the worker's transitions
+	// for them always land after it. Children a previous attempt already
+	// sent cannot be claimed again and are left out.
+	tracked := store != nil && parent.RunId != ""
+	if tracked {
+		if err := checkChildIds(ctx, store, parent, childIds); err != nil {
+			return nil, err
+		}
+
+		unsent := queued[:0]
+		for _, child := range queued {
+			err := store.Record(ctx, workstatus.Transition{
+				RunId:          child.Item.RunId,
+				WorkId:         child.Item.ID,
+				WorkType:       child.Item.Type,
+				Status:         workstatus.Queued,
+				CorrelationId:  child.Item.CorrelationId,
+				ParentWorkId:   parent.ID,
+				ClaimForParent: true,
+			})
+			if errors.Is(err, workstatus.ErrChanged) {
+				sent, err := sentChild(ctx, store, parent, child.Item.ID)
+				if err != nil {
+					return nil, err
+				}
+				if sent {
+					continue
+				}
+				return nil, fmt.Errorf("child work ID %d of work item %d is already used in run %s", child.Item.ID, parent.ID, parent.RunId)
+			}
+			if err != nil {
+				slog.WarnContext(ctx, "Failed to record child work item status", "child_work_id", child.Item.ID, "error", err)
+			}
+			unsent = append(unsent, child)
+		}
+		queued = unsent
+	}
+
+	status := "sent"
+	sent, err := enqueueWorkItems(ctx, queued)
+	if err != nil {
+		status = "failed"
+	}
+
+	// Mark what was sent, even if part of the batch failed, so a retry only
+	// sends the rest
+	if tracked {
+		for workId, messageId := range sent {
+			if err := store.MarkSent(ctx, parent.RunId, workId, messageId); err != nil {
+				slog.WarnContext(ctx, "Failed to mark child work item sent", "child_work_id", workId, "error", err)
+			}
+		}
+	}
+
+	// Record fan-out metrics
+	metrics.Event("work_item_fanout", telemetry.Tags{
+		"work_type": parent.Type,
+		"status":    status,
+	}, telemetry.Fields{
+		"work_id":     parent.ID,
+		"child_count": len(children),
+	})
+
+	if err != nil {
+		return nil, retryable(fmt.Errorf("failed to enqueue child work items of work item %d: %w", parent.ID, err))
+	}
+
+	if store != nil && parent.RunId != "" {
+		if err := store.LinkChildren(ctx, parent.RunId, parent.ID, childIds); err != nil {
+			slog.WarnContext(ctx, "Failed to link child work items", "error", err)
+		}
+	}
+
+	slog.InfoContext(ctx, "Enqueued child work items", "child_work_ids", childIds)
+	return childIds, nil
+}
+
+// sentChild reports whether a child ID that could not be claimed belongs to
+// a child of parent that an earlier attempt already sent.
+func sentChild(ctx context.Context, store *workstatus.Store, parent WorkItem, childId int) (bool, error) {
+	state, err := store.Get(ctx, parent.RunId, childId)
+	if err != nil {
+		return false, retryable(err)
+	}
+	return state != nil && state.ParentWorkId == parent.ID, nil
+}
+
+// checkChildIds fails when another item of the parent's run already uses
+// one of its child IDs, before any of them is claimed.
+func checkChildIds(ctx context.Context, store *workstatus.Store, parent WorkItem, childIds []int) error {
+	states, err := store.ListRun(ctx, parent.RunId)
+	if err != nil {
+		return retryable(err)
+	}
+
+	for _, state := range states {
+		if state.ParentWorkId != parent.ID && containsWorkId(childIds, state.WorkId) {
+			return fmt.Errorf("child work ID %d of work item %d is already used in run %s", state.WorkId, parent.ID, parent.RunId)
+		}
+	}
+	return nil
+}
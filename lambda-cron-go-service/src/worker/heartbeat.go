@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"lambda-cron-go-service/internal/env"
+	"lambda-cron-go-service/internal/telemetry"
+)
+
+const defaultHeartbeatInterval = 60 * time.Second
+
+// errHeartbeatFailed is the cancellation cause of a processor whose message
+// could no longer be kept hidden.
+var errHeartbeatFailed = errors.New("visibility heartbeat failed")
+
+// heartbeatInterval is how often a running item's message visibility is
+// extended, from VISIBILITY_HEARTBEAT_SECONDS. Each beat hides the message
+// for two intervals, so one slow call does not let it reappear.
+func heartbeatInterval() time.Duration {
+	return time.Duration(env.Int("VISIBILITY_HEARTBEAT_SECONDS", int(defaultHeartbeatInterval.Seconds()))) * time.Second
+}
+
+// startHeartbeat keeps record hidden from other consumers while its work
+// item is processed. The returned context is cancelled if a heartbeat
+// fails, since another worker may then pick the message up. stop ends the
+// heartbeat and returns the heartbeat error, if any.
+func startHeartbeat(ctx context.Context, record events.SQSMessage, workItem WorkItem, metrics telemetry.MetricsSink) (context.Context, func() error) {
+	processCtx, cancel := context.WithCancelCause(ctx)
+	interval := heartbeatInterval()
+
+	var wg sync.WaitGroup
+	var heartbeatErr error
+	beats := 0
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-processCtx.Done():
+				return
+			case <-ticker.C:
+				if err := changeMessageVisibility(processCtx, record, 2*interval); err != nil {
+					if processCtx.Err() != nil {
+						return
+					}
+					heartbeatErr = err
+					slog.WarnContext(ctx, "Visibility heartbeat failed, cancelling the work item", "error", err)
+					cancel(fmt.Errorf("%w: %v", errHeartbeatFailed, err))
+					return
+				}
+				beats++
+			}
+		}
+	}()
+
+	stop := func() error {
+		cancel(nil)
+		wg.Wait()
+
+		// Record heartbeat activity for items that needed it
+		if beats > 0 || heartbeatErr != nil {
+			status := "ok"
+			if heartbeatErr != nil {
+				status = "failed"
+			}
+
+			metrics.Event("visibility_heartbeat", telemetry.Tags{
+				"work_type": workItem.Type,
+				"status":    status,
+			}, telemetry.Fields{
+				"work_id":    workItem.ID,
+				"heartbeats": beats,
+			})
+		}
+
+		return heartbeatErr
+	}
+
+	return processCtx, stop
+}
+
+// sleepContext waits for d or until ctx is done, whichever comes first.
+// The error for a done ctx is permanent; Handler makes it retryable.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"lambda-cron-go-service/internal/telemetry"
+)
+
+// enqueuedAtAttribute is the message attribute holding the time, in Unix
+// milliseconds, a work item was first handed to the queue. The producer and
+// workItemAttributes stamp it on every message.
+const enqueuedAtAttribute = "enqueuedAt"
+
+// recordWorkItemLatency writes the work_item_latency measurement for a
+// record the worker has finished with, tagged by work type and status so
+// SLOs can be set per type on successful items:
+//
+//   - queue_wait_ms is how long SQS held the message before first
+//     delivering it, message delays included. Both ends are SQS's clock.
+//   - end_to_end_ms runs from the enqueue stamp to finishedAt, across every
+//     delivery. Both ends are Lambda's clock; messages without a stamp fall
+//     back to SentTimestamp.
+//   - receive_count is the delivery this was, counting from 1.
+func recordWorkItemLatency(metrics telemetry.MetricsSink, record events.SQSMessage, workType, status string, finishedAt time.Time) {
+	sentAt, sent := sqsTimestamp(record.Attributes["SentTimestamp"])
+	firstReceivedAt, received := sqsTimestamp(record.Attributes["ApproximateFirstReceiveTimestamp"])
+	receiveCount, _ := strconv.Atoi(record.Attributes["ApproximateReceiveCount"])
+
+	enqueuedAt, enqueued := sentAt, sent
+	if attr, ok := record.MessageAttributes[enqueuedAtAttribute]; ok && attr.StringValue != nil {
+		if stamp, ok := sqsTimestamp(*attr.StringValue); ok {
+			enqueuedAt, enqueued = stamp, true
+		}
+	}
+
+	fields := telemetry.Fields{"receive_count": receiveCount}
+	if sent && received {
+		fields["queue_wait_ms"] = firstReceivedAt.Sub(sentAt).Milliseconds()
+	}
+	if enqueued {
+		fields["end_to_end_ms"] = finishedAt.Sub(enqueuedAt).Milliseconds()
+	}
+
+	metrics.Event("work_item_latency", telemetry.Tags{
+		"work_type": workType,
+		"status":    status,
+	}, fields)
+}
+
+// sqsTimestamp parses a timestamp in Unix milliseconds, the format SQS
+// uses for its message system attributes.
+func sqsTimestamp(value string) (time.Time, bool) {
+	millis, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || millis <= 0 {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(millis), true
+}
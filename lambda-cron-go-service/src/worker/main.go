@@ -4,33 +4,42 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"math/rand"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
-	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
-	"github.com/influxdata/influxdb-client-go/v2/api"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"lambda-cron-go-service/internal/telemetry"
+	"lambda-cron-go-service/internal/workstatus"
 )
 
 type WorkerResponse struct {
-	StatusCode int             `json:"statusCode"`
-	Timestamp  string          `json:"timestamp"`
-	Environment string         `json:"environment"`
-	Processing ProcessingSummary `json:"processing"`
+	StatusCode        int                          `json:"statusCode"`
+	Timestamp         string                       `json:"timestamp"`
+	Environment       string                       `json:"environment"`
+	Processing        ProcessingSummary            `json:"processing"`
+	BatchItemFailures []events.SQSBatchItemFailure `json:"batchItemFailures"`
+	MetricsErrors     int                          `json:"metricsErrors"`
+	MetricsDegraded   bool                         `json:"metricsDegraded"`
 }
 
 type ProcessingSummary struct {
 	TotalMessages      int                `json:"totalMessages"`
 	SuccessfulMessages int                `json:"successfulMessages"`
 	FailedMessages     int                `json:"failedMessages"`
+	DeferredMessages   int                `json:"deferredMessages"`
+	DrainedMessages    int                `json:"drainedMessages"`
 	ProcessedItems     []ProcessedMessage `json:"processedItems"`
 	FailedItems        []ProcessedMessage `json:"failedItems"`
+	DeferredItems      []ProcessedMessage `json:"deferredItems"`
 }
 
 type ProcessedMessage struct {
@@ -42,94 +51,125 @@ type ProcessedMessage struct {
 }
 
 type WorkItem struct {
-	ID      int                    `json:"id"`
-	Type    string                 `json:"type"`
-	Payload map[string]interface{} `json:"payload"`
-}
-
-type InfluxDBCredentials struct {
-	Token string `json:"token"`
+	ID            int                    `json:"id"`
+	Type          string                 `json:"type"`
+	Payload       map[string]interface{} `json:"payload"`
+	CorrelationId string                 `json:"correlationId,omitempty"`
+	RunId         string                 `json:"runId,omitempty"`
+	DependsOn     []int                  `json:"dependsOn,omitempty"`
+	ParentId      int                    `json:"parentId,omitempty"`
 }
 
 func Handler(ctx context.Context, sqsEvent events.SQSEvent) (WorkerResponse, error) {
-	log.Printf("Worker Lambda triggered at: %s", time.Now().UTC().Format(time.RFC3339))
-	log.Printf("Event: %+v", sqsEvent)
+	defer telemetry.FlushTraces(ctx)
+
+	slog.InfoContext(ctx, "Worker Lambda triggered", "records", len(sqsEvent.Records))
+	if slog.Default().Enabled(ctx, slog.LevelDebug) {
+		// Record bodies are not logged; their payloads are logged redacted
+		// as each item is processed
+		messageIds := make([]string, 0, len(sqsEvent.Records))
+		for _, record := range sqsEvent.Records {
+			messageIds = append(messageIds, record.MessageId)
+		}
+		slog.DebugContext(ctx, "Worker event", "message_ids", messageIds)
+	}
 
 	var processedMessages []ProcessedMessage
 	var failedMessages []ProcessedMessage
-	var influxClient influxdb2.Client
-	var writeAPI api.WriteAPI
-
-	// Initialize AWS config with automatic region detection
-	cfg, err := config.LoadDefaultConfig(ctx)
+	var deferredMessages []ProcessedMessage
+	batchItemFailures := []events.SQSBatchItemFailure{}
+	drainedMessages := 0
+	metricsErrors := 0
+	metricsFailed := false
+
+	// Clients are created once per execution environment and reused by
+	// warm invocations
+	cfg, err := telemetry.GetAWSConfig(ctx)
 	if err != nil {
-		log.Printf("Failed to load AWS config: %v", err)
+		slog.ErrorContext(ctx, "Failed to load AWS config", "error", err)
 		return createWorkerErrorResponse(fmt.Sprintf("Failed to load AWS config: %v", err), len(sqsEvent.Records)), err
 	}
 
-	secretsMgr := secretsmanager.NewFromConfig(cfg)
-
-	defer func() {
-		if writeAPI != nil {
-			writeAPI.Flush()
-			if influxClient != nil {
-				influxClient.Close()
-			}
-			log.Println("InfluxDB connection closed")
-		}
-	}()
-
-	// Get InfluxDB credentials from AWS Secrets Manager
-	secretArn := os.Getenv("INFLUXDB_SECRET_ARN")
-	secretInput := &secretsmanager.GetSecretValueInput{
-		SecretId:     aws.String(secretArn),
-		VersionStage: aws.String("AWSCURRENT"),
-	}
-
-	secretResult, err := secretsMgr.GetSecretValue(ctx, secretInput)
+	publisher, err := newCompletionPublisher(cfg)
 	if err != nil {
-		errMsg := fmt.Sprintf("Failed to retrieve secret: %v", err)
-		log.Println(errMsg)
+		errMsg := fmt.Sprintf("Failed to configure completion events: %v", err)
+		slog.ErrorContext(ctx, errMsg)
 		return createWorkerErrorResponse(errMsg, len(sqsEvent.Records)), err
 	}
 
-	var credentials InfluxDBCredentials
-	if err := json.Unmarshal([]byte(*secretResult.SecretString), &credentials); err != nil {
-		errMsg := fmt.Sprintf("Failed to parse credentials: %v", err)
-		log.Println(errMsg)
+	statuses := workstatus.NewStore(cfg)
+
+	metrics, metricsDegraded, err := telemetry.GetMetricsSink(ctx)
+	if err != nil {
+		errMsg := fmt.Sprintf("Failed to set up metrics: %v", err)
+		slog.ErrorContext(ctx, errMsg)
 		return createWorkerErrorResponse(errMsg, len(sqsEvent.Records)), err
 	}
 
-	influxURL := os.Getenv("INFLUXDB_URL")
-	influxOrg := os.Getenv("INFLUXDB_ORG")
-	influxBucket := os.Getenv("INFLUXDB_BUCKET")
 	environment := os.Getenv("ENVIRONMENT")
 
-	// Initialize InfluxDB client
-	influxClient = influxdb2.NewClientWithOptions(
-		influxURL,
-		credentials.Token,
-		influxdb2.DefaultOptions().SetUseGZip(true),
-	)
-
-	writeAPI = influxClient.WriteAPI(influxOrg, influxBucket)
-	// WriteAPI options can be set if needed
+	// Process each SQS record
+	margin := drainMargin()
+	for i, record := range sqsEvent.Records {
+		// Stop before Lambda's timeout would kill the batch and have SQS
+		// redeliver records that already succeeded, or once the batch is
+		// cancelled; hand back only the records not yet started
+		if ctx.Err() != nil || nearDeadline(ctx, margin) {
+			unstarted := sqsEvent.Records[i:]
+			slog.WarnContext(ctx, "Invocation deadline is near, returning unstarted records to the queue",
+				"safety_margin_ms", margin.Milliseconds(),
+				"records_returned", len(unstarted))
+
+			for _, remaining := range unstarted {
+				batchItemFailures = append(batchItemFailures, events.SQSBatchItemFailure{
+					ItemIdentifier: remaining.MessageId,
+				})
+			}
+			drainedMessages = len(unstarted)
 
-	log.Println("Connected to InfluxDB")
+			// Record the drain
+			metrics.Event("worker_batch_drain", nil, telemetry.Fields{
+				"records_drained":  drainedMessages,
+				"records_total":    len(sqsEvent.Records),
+				"safety_margin_ms": margin.Milliseconds(),
+			})
+			break
+		}
 
-	// Process each SQS record
-	for _, record := range sqsEvent.Records {
 		startTime := time.Now()
 		var workItem WorkItem
 		status := "success"
 		var errorMessage *string
 
-		log.Printf("Processing SQS record: %s", record.MessageId)
+		ctx := telemetry.WithLogAttrs(ctx, slog.String("message_id", record.MessageId))
+
+		// Continue the producer's trace, one span per record
+		ctx = otel.GetTextMapPropagator().Extract(ctx, sqsTraceCarrier(record.MessageAttributes))
+		ctx, span := telemetry.Tracer().Start(ctx, "process message",
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(
+				attribute.String("messaging.system", "aws_sqs"),
+				attribute.String("messaging.message.id", record.MessageId),
+			))
+
+		slog.DebugContext(ctx, "Processing SQS record")
 
 		// Parse the work item from SQS message
-		if err := json.Unmarshal([]byte(record.Body), &workItem); err != nil {
-			errMsg := fmt.Sprintf("Failed to parse work item: %v", err)
-			log.Printf("Failed to parse work item from message %s: %v", record.MessageId, err)
+		parseErr := json.Unmarshal([]byte(record.Body), &workItem)
+		if parseErr == nil {
+			ctx = telemetry.WithLogAttrs(ctx,
+				slog.String("run_id", workItem.RunId),
+				slog.Int("work_id", workItem.ID),
+				slog.String("work_type", workItem.Type))
+			span.SetAttributes(
+				attribute.String("run_id", workItem.RunId),
+				attribute.Int("work_id", workItem.ID),
+				attribute.String("work_type", workItem.Type))
+		}
+
+		if parseErr != nil {
+			errMsg := fmt.Sprintf("Failed to parse work item: %v", parseErr)
+			slog.ErrorContext(ctx, "Failed to parse work item", "error", parseErr)
 			status = "error"
 			errorMessage = &errMsg
 
@@ -140,16 +180,133 @@ func Handler(ctx context.Context, sqsEvent events.SQSEvent) (WorkerResponse, err
 				Status:    status,
 				Error:     errorMessage,
 			})
+		} else if stored := storedStatus(ctx, statuses, workItem); stored == workstatus.Succeeded {
+			// A redelivery of an item that already succeeded, usually because
+			// releasing its dependents failed; only retry the release
+			slog.InfoContext(ctx, "Work item already succeeded, skipping processing")
+			status = "duplicate"
+
+			if err := settleDependents(ctx, statuses, workItem, workstatus.Succeeded); err != nil {
+				slog.WarnContext(ctx, "Failed to release dependents of work item, will retry", "error", err)
+				batchItemFailures = append(batchItemFailures, events.SQSBatchItemFailure{
+					ItemIdentifier: record.MessageId,
+				})
+			}
+
+			processedMessages = append(processedMessages, ProcessedMessage{
+				WorkId:    workItem.ID,
+				MessageId: record.MessageId,
+				Type:      workItem.Type,
+				Status:    status,
+			})
+		} else if workItem.Type == "workflow" && stored == workstatus.Running {
+			// A redelivery of a workflow item whose execution was started
+			// and is already followed by status checks; starting it again
+			// would queue a second chain of checks
+			slog.InfoContext(ctx, "Workflow execution already running, skipping processing")
+			status = "duplicate"
+
+			processedMessages = append(processedMessages, ProcessedMessage{
+				WorkId:    workItem.ID,
+				MessageId: record.MessageId,
+				Type:      workItem.Type,
+				Status:    status,
+			})
+		} else if isPaused(ctx, workItem.Type, metrics) {
+			// Paused during an incident: keep the message on the queue
+			// until the pause list lets the type through again
+			hold := pauseHoldDuration()
+			slog.InfoContext(ctx, "Work type is paused, holding work item", "hold", hold.String())
+			status = "paused"
+
+			if err := changeMessageVisibility(ctx, record, hold); err != nil {
+				slog.WarnContext(ctx, "Failed to hold work item, leaving it to the queue's visibility timeout", "error", err)
+			}
+			batchItemFailures = append(batchItemFailures, events.SQSBatchItemFailure{
+				ItemIdentifier: record.MessageId,
+			})
+
+			deferredMessages = append(deferredMessages, ProcessedMessage{
+				WorkId:    workItem.ID,
+				MessageId: record.MessageId,
+				Type:      workItem.Type,
+				Status:    status,
+			})
+		} else if delay := throttleWorkItem(ctx, workItem, metrics); delay > 0 {
+			// Over its type's rate limit: hand the message back to SQS to
+			// be delivered again once tokens are available
+			slog.InfoContext(ctx, "Deferring work item to respect its rate limit", "delay", delay.String())
+			status = "deferred"
+
+			if err := deferMessage(ctx, record, delay); err != nil {
+				slog.WarnContext(ctx, "Failed to defer work item, leaving it to the queue's visibility timeout", "error", err)
+			}
+			batchItemFailures = append(batchItemFailures, events.SQSBatchItemFailure{
+				ItemIdentifier: record.MessageId,
+			})
+
+			deferredMessages = append(deferredMessages, ProcessedMessage{
+				WorkId:    workItem.ID,
+				MessageId: record.MessageId,
+				Type:      workItem.Type,
+				Status:    status,
+			})
 		} else {
-			log.Printf("Processing work item %d of type %s", workItem.ID, workItem.Type)
+			slog.InfoContext(ctx, "Processing work item")
 
-			// Process the work item based on its type
-			if err := processWorkItem(workItem, writeAPI); err != nil {
+			attempt, _ := strconv.Atoi(record.Attributes["ApproximateReceiveCount"])
+			if workItem.Type != "workflow_status" {
+				// Status checks leave the workflow item running
+				recordStatus(ctx, statuses, workItem, record, workstatus.InProgress, attempt, nil)
+			}
+
+			// Process the work item based on its type, keeping its message
+			// hidden for as long as that takes
+			processCtx, stopHeartbeat := startHeartbeat(ctx, record, workItem, metrics)
+			results, err := processWorkItem(processCtx, statuses, workItem, metrics)
+			if err != nil && !isRetryable(err) && processCtx.Err() != nil {
+				// Interrupted by the invocation deadline, a poller shutdown
+				// or a failed heartbeat rather than failed, so SQS
+				// redelivers it
+				err = retryable(fmt.Errorf("work item %d interrupted: %w", workItem.ID, err))
+			}
+			if heartbeatErr := stopHeartbeat(); heartbeatErr != nil && err != nil {
+				// The message may already be with another worker
+				err = retryable(fmt.Errorf("work item %d abandoned: %w", workItem.ID, heartbeatErr))
+			}
+			deadLettered, running := false, false
+			if err != nil {
 				errMsg := err.Error()
-				log.Printf("Failed to process work item %d: %v", workItem.ID, err)
 				status = "error"
 				errorMessage = &errMsg
 
+				if isRetryable(err) {
+					// Leave the message on the queue so SQS redelivers it
+					slog.WarnContext(ctx, "Transient failure processing work item, will retry", "attempt", attempt, "error", err)
+					status = "retry"
+					batchItemFailures = append(batchItemFailures, events.SQSBatchItemFailure{
+						ItemIdentifier: record.MessageId,
+					})
+
+					// SQS moves the message to the DLQ once it has been
+					// received maxReceiveCount times
+					if attempt >= maxReceiveCount() {
+						deadLettered = true
+						recordStatus(ctx, statuses, workItem, record, workstatus.DeadLettered, attempt, errorMessage)
+						if err := settleDependents(ctx, statuses, workItem, workstatus.DeadLettered); err != nil {
+							slog.WarnContext(ctx, "Failed to skip dependents of work item", "error", err)
+						}
+					} else {
+						recordStatus(ctx, statuses, workItem, record, workstatus.Retrying, attempt, errorMessage)
+					}
+				} else {
+					slog.ErrorContext(ctx, "Failed to process work item", "attempt", attempt, "error", err)
+					recordStatus(ctx, statuses, workItem, record, workstatus.Failed, attempt, errorMessage)
+					if err := settleDependents(ctx, statuses, workItem, workstatus.Failed); err != nil {
+						slog.WarnContext(ctx, "Failed to skip dependents of work item", "error", err)
+					}
+				}
+
 				failedMessages = append(failedMessages, ProcessedMessage{
 					WorkId:    workItem.ID,
 					MessageId: record.MessageId,
@@ -165,45 +322,94 @@ func Handler(ctx context.Context, sqsEvent events.SQSEvent) (WorkerResponse, err
 					Status:    status,
 				})
 
-				log.Printf("Successfully processed work item %d", workItem.ID)
+				slog.InfoContext(ctx, "Successfully processed work item")
+				if running = awaitingWorkflow(results); running {
+					// Dependents wait for the workflow to finish, which a
+					// later status check records
+					recordStatus(ctx, statuses, workItem, record, workstatus.Running, attempt, nil)
+				} else {
+					recordStatus(ctx, statuses, workItem, record, workstatus.Succeeded, attempt, nil)
+
+					// A failed release is retried through redelivery, which
+					// the succeeded status above turns into a release-only
+					// pass
+					if err := settleDependents(ctx, statuses, workItem, workstatus.Succeeded); err != nil {
+						slog.WarnContext(ctx, "Failed to release dependents of work item, will retry", "error", err)
+						batchItemFailures = append(batchItemFailures, events.SQSBatchItemFailure{
+							ItemIdentifier: record.MessageId,
+						})
+					}
+				}
+			}
+
+			// Let downstream consumers know the item reached a final state,
+			// which a retry on its last receive is since SQS dead-letters it
+			if publisher != nil && !running && (status != "retry" || deadLettered) {
+				publishCompletionEvent(ctx, publisher, workItem, record, status, results, errorMessage, time.Since(startTime), environment)
 			}
 		}
 
 		// Log the processing attempt
-		log.Printf("Work item processing completed for message %s: status=%s, duration=%dms",
-			record.MessageId, status, time.Since(startTime).Milliseconds())
-
-		// Write metrics to InfluxDB
-		if writeAPI != nil {
-			workType := "unknown"
-			workId := 0
-			if status != "error" || workItem.Type != "" {
-				workType = workItem.Type
-				workId = workItem.ID
-			}
+		slog.InfoContext(ctx, "Work item processing completed",
+			"status", status,
+			"duration_ms", time.Since(startTime).Milliseconds())
 
-			point := influxdb2.NewPointWithMeasurement("work_item_processing").
-				AddTag("work_type", workType).
-				AddTag("status", status).
-				AddTag("message_id", record.MessageId).
-				AddField("work_id", workId).
-				AddField("duration_ms", time.Since(startTime).Milliseconds()).
-				SetTime(time.Now())
+		span.SetAttributes(attribute.String("status", status))
+		if errorMessage != nil {
+			span.SetStatus(codes.Error, *errorMessage)
+		}
+		span.End()
+
+		// Record the attempt
+		workType := "unknown"
+		workId := 0
+		if status != "error" || workItem.Type != "" {
+			workType = workItem.Type
+			workId = workItem.ID
+		}
 
-			if errorMessage != nil {
-				point = point.AddField("error_message", *errorMessage)
-			}
+		fields := telemetry.Fields{
+			"work_id":     workId,
+			"message_id":  record.MessageId,
+			"duration_ms": time.Since(startTime).Milliseconds(),
+		}
 
-			writeAPI.WritePoint(point)
+		if errorMessage != nil {
+			fields["error_message"] = *errorMessage
+		}
+
+		metrics.Event("work_item_processing", telemetry.Tags{
+			"work_type": workType,
+			"status":    status,
+		}, fields)
+		recordWorkItemLatency(metrics, record, workType, status, time.Now())
+
+		// Write the record's metrics out on their own, so under the "fail"
+		// policy a failed write hands back only this record
+		flushErrors, flushErr := telemetry.FlushMetrics(ctx, metrics)
+		metricsErrors += flushErrors
+		if flushErr != nil {
+			metricsFailed = true
+			if !hasBatchItemFailure(batchItemFailures, record.MessageId) {
+				batchItemFailures = append(batchItemFailures, events.SQSBatchItemFailure{
+					ItemIdentifier: record.MessageId,
+				})
+			}
 		}
 	}
 
 	// Determine status code based on processing results
 	statusCode := 200
-	if len(failedMessages) > 0 {
+	if len(failedMessages) > 0 || drainedMessages > 0 || metricsFailed {
 		statusCode = 207 // Multi-Status for partial failures
 	}
 
+	// Write out the batch's own points before answering; nothing may be
+	// left buffered when Lambda freezes the environment. They belong to no
+	// record, so failed writes are counted but hand nothing back.
+	flushErrors, _ := telemetry.FlushMetrics(ctx, metrics)
+	metricsErrors += flushErrors
+
 	response := WorkerResponse{
 		StatusCode:  statusCode,
 		Timestamp:   time.Now().UTC().Format(time.RFC3339),
@@ -212,227 +418,271 @@ func Handler(ctx context.Context, sqsEvent events.SQSEvent) (WorkerResponse, err
 			TotalMessages:      len(sqsEvent.Records),
 			SuccessfulMessages: len(processedMessages),
 			FailedMessages:     len(failedMessages),
+			DeferredMessages:   len(deferredMessages),
+			DrainedMessages:    drainedMessages,
 			ProcessedItems:     processedMessages,
 			FailedItems:        failedMessages,
+			DeferredItems:      deferredMessages,
 		},
+		BatchItemFailures: batchItemFailures,
+		MetricsErrors:     metricsErrors,
+		MetricsDegraded:   metricsDegraded,
 	}
 
-	log.Printf("Worker processing completed: %+v", response)
+	slog.InfoContext(ctx, "Worker processing completed",
+		"status_code", statusCode,
+		"successful_messages", len(processedMessages),
+		"failed_messages", len(failedMessages),
+		"deferred_messages", len(deferredMessages),
+		"drained_messages", drainedMessages,
+		"metrics_errors", metricsErrors)
 	return response, nil
 }
 
-func processWorkItem(workItem WorkItem, writeAPI api.WriteAPI) error {
+// hasBatchItemFailure reports whether a message is already handed back to
+// SQS.
+func hasBatchItemFailure(failures []events.SQSBatchItemFailure, messageId string) bool {
+	for _, failure := range failures {
+		if failure.ItemIdentifier == messageId {
+			return true
+		}
+	}
+	return false
+}
+
+func processWorkItem(ctx context.Context, statuses *workstatus.Store, workItem WorkItem, metrics telemetry.MetricsSink) (results WorkResult, err error) {
 	startTime := time.Now()
 
+	ctx, span := telemetry.Tracer().Start(ctx, "process "+workItem.Type)
+	defer func() { telemetry.EndSpan(span, err) }()
+
 	switch workItem.Type {
 	case "data_processing":
-		if err := processDataItem(workItem.Payload, writeAPI); err != nil {
-			return err
-		}
+		results, err = processDataItem(ctx, workItem.Payload, metrics)
 	case "email_notification":
-		if err := processEmailNotification(workItem.Payload, writeAPI); err != nil {
-			return err
-		}
+		results, err = processEmailNotification(ctx, workItem.Payload, metrics)
 	case "data_cleanup":
-		if err := processDataCleanup(workItem.Payload, writeAPI); err != nil {
-			return err
-		}
+		results, err = processDataCleanup(ctx, workItem.Payload, metrics)
 	case "report_generation":
-		if err := processReportGeneration(workItem.Payload, writeAPI); err != nil {
-			return err
-		}
+		results, err = processReportGeneration(ctx, workItem, metrics)
 	case "backup_task":
-		if err := processBackupTask(workItem.Payload, writeAPI); err != nil {
-			return err
-		}
+		results, err = processBackupTask(ctx, workItem.Payload, metrics)
+	case "workflow":
+		results, err = processWorkflow(ctx, workItem, metrics)
+	case "workflow_status":
+		results, err = processWorkflowStatus(ctx, workItem, metrics)
 	default:
-		return fmt.Errorf("unknown work item type: %s", workItem.Type)
+		return nil, fmt.Errorf("unknown work item type: %s", workItem.Type)
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	// Log successful completion to InfluxDB
-	if writeAPI != nil {
-		point := influxdb2.NewPointWithMeasurement("work_item_completed").
-			AddTag("work_type", workItem.Type).
-			AddField("work_id", workItem.ID).
-			AddField("processing_duration_ms", time.Since(startTime).Milliseconds()).
-			SetTime(time.Now())
-
-		writeAPI.WritePoint(point)
+	// Enqueue any follow-up work now that the item itself has succeeded
+	if children := takeChildren(results); len(children) > 0 {
+		childIds, err := fanOutChildren(ctx, statuses, workItem, children, metrics)
+		if err != nil {
+			return nil, err
+		}
+		results["childWorkIds"] = childIds
 	}
 
-	log.Printf("Completed processing for work item %d of type %s", workItem.ID, workItem.Type)
-	return nil
+	// Record successful completion
+	metrics.Event("work_item_completed", telemetry.Tags{
+		"work_type": workItem.Type,
+	}, telemetry.Fields{
+		"work_id":                workItem.ID,
+		"processing_duration_ms": time.Since(startTime).Milliseconds(),
+	})
+
+	slog.DebugContext(ctx, "Completed processing for work item")
+	return results, nil
 }
 
-func processDataItem(payload map[string]interface{}, writeAPI api.WriteAPI) error {
-	log.Printf("Processing data item: %+v", payload)
+func processDataItem(ctx context.Context, payload map[string]interface{}, metrics telemetry.MetricsSink) (WorkResult, error) {
+	slog.DebugContext(ctx, "Processing data item", "payload", payload)
 
 	action, ok := payload["action"].(string)
 	if !ok {
-		return fmt.Errorf("missing or invalid action in payload")
+		return nil, fmt.Errorf("missing or invalid action in payload")
 	}
 
-	if action == "update_profile" {
-		// Simulate data processing work
-		time.Sleep(100 * time.Millisecond)
-		
-		userIdFloat, ok := payload["userId"].(float64)
-		if !ok {
-			return fmt.Errorf("missing or invalid userId in payload")
-		}
-		userId := int(userIdFloat)
-		
-		log.Printf("Updated profile for user %d", userId)
-
-		// Log user activity to InfluxDB
-		if writeAPI != nil {
-			point := influxdb2.NewPointWithMeasurement("user_activity").
-				AddTag("action", action).
-				AddField("user_id", userId).
-				AddField("processing_time_ms", 100).
-				SetTime(time.Now())
-
-			writeAPI.WritePoint(point)
-		}
+	handler, ok := dataActions[action]
+	if !ok {
+		return nil, fmt.Errorf("unknown data_processing action: %s", action)
 	}
 
-	return nil
+	return handler(ctx, payload, metrics)
 }
 
-func processEmailNotification(payload map[string]interface{}, writeAPI api.WriteAPI) error {
-	log.Printf("Processing email notification: %+v", payload)
+func processEmailNotification(ctx context.Context, payload map[string]interface{}, metrics telemetry.MetricsSink) (WorkResult, error) {
+	slog.DebugContext(ctx, "Processing email notification", "payload", payload)
 
 	email, ok := payload["email"].(string)
 	if !ok {
-		return fmt.Errorf("missing or invalid email in payload")
+		return nil, fmt.Errorf("missing or invalid email in payload")
 	}
 
 	template, ok := payload["template"].(string)
 	if !ok {
-		return fmt.Errorf("missing or invalid template in payload")
+		return nil, fmt.Errorf("missing or invalid template in payload")
 	}
 
 	// Simulate email sending work
-	time.Sleep(200 * time.Millisecond)
-	log.Printf("Email notification sent to %s using template %s", email, template)
-
-	// Log email metrics to InfluxDB
-	if writeAPI != nil {
-		point := influxdb2.NewPointWithMeasurement("email_notifications").
-			AddTag("template", template).
-			AddTag("status", "sent").
-			AddField("recipient", email).
-			AddField("delivery_time_ms", 200).
-			SetTime(time.Now())
-
-		writeAPI.WritePoint(point)
+	err := withCircuitBreaker(ctx, "ses", metrics, func() error {
+		return sleepContext(ctx, 200*time.Millisecond)
+	})
+	if err != nil {
+		return nil, err
 	}
-
-	return nil
+	slog.InfoContext(ctx, "Email notification sent", "email", email, "template", template)
+
+	// Record email metrics
+	metrics.Event("email_notifications", telemetry.Tags{
+		"template": template,
+		"status":   "sent",
+	}, telemetry.Fields{
+		"recipient":        email,
+		"delivery_time_ms": 200,
+	})
+
+	return WorkResult{"template": template}, nil
 }
 
-func processDataCleanup(payload map[string]interface{}, writeAPI api.WriteAPI) error {
-	log.Printf("Processing data cleanup: %+v", payload)
+func processDataCleanup(ctx context.Context, payload map[string]interface{}, metrics telemetry.MetricsSink) (WorkResult, error) {
+	slog.DebugContext(ctx, "Processing data cleanup", "payload", payload)
 
 	table, ok := payload["table"].(string)
 	if !ok {
-		return fmt.Errorf("missing or invalid table in payload")
+		return nil, fmt.Errorf("missing or invalid table in payload")
 	}
 
 	daysFloat, ok := payload["days"].(float64)
 	if !ok {
-		return fmt.Errorf("missing or invalid days in payload")
+		return nil, fmt.Errorf("missing or invalid days in payload")
 	}
 	days := int(daysFloat)
 
+	results := WorkResult{"table": table}
+
 	if table == "old_logs" {
 		// Simulate cleanup operation
-		time.Sleep(150 * time.Millisecond)
-		recordsDeleted := rand.Intn(100) // Simulate random cleanup count
-		log.Printf("Cleaned up %d records from %s older than %d days", recordsDeleted, table, days)
-
-		// Log cleanup metrics to InfluxDB
-		if writeAPI != nil {
-			point := influxdb2.NewPointWithMeasurement("data_cleanup").
-				AddTag("table", table).
-				AddField("records_deleted", recordsDeleted).
-				AddField("retention_days", days).
-				AddField("cleanup_time_ms", 150).
-				SetTime(time.Now())
-
-			writeAPI.WritePoint(point)
+		if err := sleepContext(ctx, 150*time.Millisecond); err != nil {
+			return nil, err
 		}
+		recordsDeleted := rand.Intn(100) // Simulate random cleanup count
+		slog.InfoContext(ctx, "Cleaned up records", "records_deleted", recordsDeleted, "table", table, "days", days)
+
+		// Record cleanup metrics
+		metrics.Event("data_cleanup", telemetry.Tags{
+			"table": table,
+		}, telemetry.Fields{
+			"records_deleted": recordsDeleted,
+			"retention_days":  days,
+			"cleanup_time_ms": 150,
+		})
+
+		results["recordsDeleted"] = recordsDeleted
 	}
 
-	return nil
+	return results, nil
 }
 
-func processReportGeneration(payload map[string]interface{}, writeAPI api.WriteAPI) error {
-	log.Printf("Processing report generation: %+v", payload)
+func processReportGeneration(ctx context.Context, workItem WorkItem, metrics telemetry.MetricsSink) (WorkResult, error) {
+	payload := workItem.Payload
+	slog.DebugContext(ctx, "Processing report generation", "payload", payload)
 
 	reportType, ok := payload["reportType"].(string)
 	if !ok {
-		return fmt.Errorf("missing or invalid reportType in payload")
+		return nil, fmt.Errorf("missing or invalid reportType in payload")
 	}
 
 	userIdFloat, ok := payload["userId"].(float64)
 	if !ok {
-		return fmt.Errorf("missing or invalid userId in payload")
+		return nil, fmt.Errorf("missing or invalid userId in payload")
 	}
 	userId := int(userIdFloat)
 
 	// Simulate report generation
-	time.Sleep(300 * time.Millisecond)
+	if err := sleepContext(ctx, 300*time.Millisecond); err != nil {
+		return nil, err
+	}
 	reportSize := rand.Intn(1000) + 100 // Simulate report size in KB
-	log.Printf("Generated %s report for user %d (%dKB)", reportType, userId, reportSize)
-
-	// Log report generation metrics to InfluxDB
-	if writeAPI != nil {
-		point := influxdb2.NewPointWithMeasurement("report_generation").
-			AddTag("report_type", reportType).
-			AddField("user_id", userId).
-			AddField("report_size_kb", reportSize).
-			AddField("generation_time_ms", 300).
-			SetTime(time.Now())
-
-		writeAPI.WritePoint(point)
+	slog.InfoContext(ctx, "Generated report", "report_type", reportType, "user_id", userId, "report_size_kb", reportSize)
+
+	results := WorkResult{"reportType": reportType, "reportSizeKb": reportSize}
+
+	// Store the report when a reports bucket is configured
+	if bucket := os.Getenv("REPORTS_BUCKET"); bucket != "" {
+		var key string
+		err := withCircuitBreaker(ctx, "s3", metrics, func() error {
+			var err error
+			key, err = storeReport(ctx, bucket, workItem, reportType, userId, reportSize)
+			return retryable(err)
+		})
+		if err != nil {
+			return nil, err
+		}
+		results["reportBucket"] = bucket
+		results["reportKey"] = key
 	}
 
-	return nil
+	// Deliver the report by email when the item names a recipient
+	if notifyEmail, ok := payload["notifyEmail"].(string); ok && notifyEmail != "" {
+		emailPayload := map[string]interface{}{
+			"email":      notifyEmail,
+			"template":   "report_ready",
+			"reportType": reportType,
+		}
+		if key, ok := results["reportKey"]; ok {
+			emailPayload["reportKey"] = key
+		}
+		results.addChild(ChildWorkItem{Type: "email_notification", Payload: emailPayload})
+	}
+
+	// Record report generation metrics
+	metrics.Event("report_generation", telemetry.Tags{
+		"report_type": reportType,
+	}, telemetry.Fields{
+		"user_ref":           userId,
+		"report_size_kb":     reportSize,
+		"generation_time_ms": 300,
+	})
+
+	return results, nil
 }
 
-func processBackupTask(payload map[string]interface{}, writeAPI api.WriteAPI) error {
-	log.Printf("Processing backup task: %+v", payload)
+func processBackupTask(ctx context.Context, payload map[string]interface{}, metrics telemetry.MetricsSink) (WorkResult, error) {
+	slog.DebugContext(ctx, "Processing backup task", "payload", payload)
 
 	database, ok := payload["database"].(string)
 	if !ok {
-		return fmt.Errorf("missing or invalid database in payload")
+		return nil, fmt.Errorf("missing or invalid database in payload")
 	}
 
 	retentionFloat, ok := payload["retention"].(float64)
 	if !ok {
-		return fmt.Errorf("missing or invalid retention in payload")
+		return nil, fmt.Errorf("missing or invalid retention in payload")
 	}
 	retention := int(retentionFloat)
 
 	// Simulate backup operation
-	time.Sleep(500 * time.Millisecond)
-	backupSize := rand.Intn(10000) + 1000 // Simulate backup size in MB
-	log.Printf("Backup completed for %s database with %d day retention (%dMB)", database, retention, backupSize)
-
-	// Log backup metrics to InfluxDB
-	if writeAPI != nil {
-		point := influxdb2.NewPointWithMeasurement("database_backup").
-			AddTag("database", database).
-			AddField("backup_size_mb", backupSize).
-			AddField("retention_days", retention).
-			AddField("backup_time_ms", 500).
-			SetTime(time.Now())
-
-		writeAPI.WritePoint(point)
+	if err := sleepContext(ctx, 500*time.Millisecond); err != nil {
+		return nil, err
 	}
-
-	return nil
+	backupSize := rand.Intn(10000) + 1000 // Simulate backup size in MB
+	slog.InfoContext(ctx, "Backup completed", "database", database, "retention_days", retention, "backup_size_mb", backupSize)
+
+	// Record backup metrics
+	metrics.Event("database_backup", telemetry.Tags{
+		"database": database,
+	}, telemetry.Fields{
+		"backup_size_mb": backupSize,
+		"retention_days": retention,
+		"backup_time_ms": 500,
+	})
+
+	return WorkResult{"database": database, "backupSizeMb": backupSize}, nil
 }
 
 func createWorkerErrorResponse(errorMessage string, totalMessages int) WorkerResponse {
@@ -451,10 +701,37 @@ func createWorkerErrorResponse(errorMessage string, totalMessages int) WorkerRes
 			FailedMessages:     totalMessages,
 			ProcessedItems:     []ProcessedMessage{},
 			FailedItems:        []ProcessedMessage{},
+			DeferredItems:      []ProcessedMessage{},
 		},
 	}
 }
 
+// main runs the worker as a Lambda SQS event source, or as a standalone
+// queue poller when WORKER_MODE is "poller".
 func main() {
+	telemetry.Init(telemetry.Service{Name: "lambda-cron-go-worker", Schema: metricsSchema, Breaker: telemetryBreakers{}})
+	if err := telemetry.SetupTracing(context.Background()); err != nil {
+		slog.Warn("Tracing disabled", "error", err)
+	}
+
+	switch os.Getenv("WORKER_MODE") {
+	case "poller":
+		err := runPoller()
+		telemetry.ShutdownTracing()
+		if err != nil {
+			slog.Error("Poller failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	case "replay-metrics":
+		err := telemetry.RunMetricsReplay()
+		telemetry.ShutdownTracing()
+		if err != nil {
+			slog.Error("Metrics replay failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	lambda.Start(Handler)
-}
\ No newline at end of file
+}
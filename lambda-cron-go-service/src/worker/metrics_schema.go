@@ -0,0 +1,67 @@
+package main
+
+import "lambda-cron-go-service/internal/telemetry"
+
+// metricsSchema is every measurement the worker writes. A tag declared as a
+// field, such as message_id, is written as a field instead.
+var metricsSchema = telemetry.Schema{
+	"circuit_breaker": {
+		Tags:   []string{"dependency", "state", "source"},
+		Fields: []string{"consecutive_failures", "open_seconds"},
+	},
+	"data_cleanup": {
+		Tags:   []string{"table"},
+		Fields: []string{"records_deleted", "retention_days", "cleanup_time_ms"},
+	},
+	"database_backup": {
+		Tags:   []string{"database"},
+		Fields: []string{"backup_size_mb", "retention_days", "backup_time_ms"},
+	},
+	"email_notifications": {
+		Tags:   []string{"template", "status"},
+		Fields: []string{"recipient", "delivery_time_ms"},
+	},
+	"rate_limit": {
+		Tags:   []string{"work_type", "decision"},
+		Fields: []string{"work_id", "delay_ms", "rate_per_second"},
+	},
+	"report_generation": {
+		Tags:   []string{"report_type"},
+		Fields: []string{"user_ref", "report_size_kb", "generation_time_ms"},
+	},
+	"user_activity": {
+		Tags:   []string{"action", "status"},
+		Fields: []string{"user_ref", "fields_updated", "processing_time_ms", "version"},
+	},
+	"visibility_heartbeat": {
+		Tags:   []string{"work_type", "status"},
+		Fields: []string{"work_id", "heartbeats"},
+	},
+	"work_item_completed": {
+		Tags:   []string{"work_type"},
+		Fields: []string{"work_id", "processing_duration_ms"},
+	},
+	"work_item_fanout": {
+		Tags:   []string{"work_type", "status"},
+		Fields: []string{"work_id", "child_count"},
+	},
+	"work_item_latency": {
+		Tags:   []string{"work_type", "status"},
+		Fields: []string{"queue_wait_ms", "end_to_end_ms", "receive_count"},
+	},
+	"work_item_processing": {
+		Tags:   []string{"work_type", "status"},
+		Fields: []string{"work_id", "message_id", "duration_ms", "error_message"},
+	},
+	"work_type_pause": {
+		Tags:   []string{"work_type", "state", "component"},
+		Fields: []string{"paused"},
+	},
+	"worker_batch_drain": {
+		Fields: []string{"records_drained", "records_total", "safety_margin_ms"},
+	},
+	"workflow_execution": {
+		Tags:   []string{"status"},
+		Fields: []string{"work_id", "execution_name", "execution_duration_ms", "status_checks"},
+	},
+}
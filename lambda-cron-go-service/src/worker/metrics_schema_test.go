@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+
+	"lambda-cron-go-service/internal/telemetry"
+)
+
+// emittedPoints is every point the worker writes, with the tags and fields
+// its code sets, optional ones included.
+var emittedPoints = []struct {
+	name   string
+	tags   telemetry.Tags
+	fields telemetry.Fields
+}{
+	{"circuit_breaker", telemetry.Tags{"dependency": "influxdb", "state": circuitOpen, "source": "local"}, telemetry.Fields{"consecutive_failures": 5, "open_seconds": 30.0}},
+	{"data_cleanup", telemetry.Tags{"table": "sessions"}, telemetry.Fields{"records_deleted": 12, "retention_days": 30, "cleanup_time_ms": 150}},
+	{"database_backup", telemetry.Tags{"database": "main"}, telemetry.Fields{"backup_size_mb": 512, "retention_days": 7, "backup_time_ms": 500}},
+	{"email_notifications", telemetry.Tags{"template": "report_ready", "status": "sent"}, telemetry.Fields{"recipient": "user@example.com", "delivery_time_ms": 200}},
+	{"rate_limit", telemetry.Tags{"work_type": "email_notification", "decision": "deferred"}, telemetry.Fields{"work_id": 1, "delay_ms": int64(500), "rate_per_second": 2.0}},
+	{"report_generation", telemetry.Tags{"report_type": "monthly"}, telemetry.Fields{"user_ref": 456, "report_size_kb": 40, "generation_time_ms": 300}},
+	{"user_activity", telemetry.Tags{"action": "update_profile", "status": "updated"}, telemetry.Fields{"user_ref": 123, "fields_updated": 1, "processing_time_ms": int64(12), "version": 2}},
+	{"visibility_heartbeat", telemetry.Tags{"work_type": "backup_task", "status": "extended"}, telemetry.Fields{"work_id": 1, "heartbeats": 3}},
+	{"work_item_completed", telemetry.Tags{"work_type": "backup_task"}, telemetry.Fields{"work_id": 1, "processing_duration_ms": int64(800)}},
+	{"work_item_fanout", telemetry.Tags{"work_type": "report_generation", "status": "enqueued"}, telemetry.Fields{"work_id": 4, "child_count": 1}},
+	{"work_item_latency", telemetry.Tags{"work_type": "backup_task", "status": "success"}, telemetry.Fields{"receive_count": 1, "queue_wait_ms": int64(40), "end_to_end_ms": int64(900)}},
+	{"work_item_processing", telemetry.Tags{"work_type": "backup_task", "status": "error"}, telemetry.Fields{"work_id": 1, "message_id": "m-1", "duration_ms": int64(800), "error_message": "boom"}},
+	{"work_type_pause", telemetry.Tags{"work_type": "backup_task", "state": "paused", "component": "worker"}, telemetry.Fields{"paused": true}},
+	{"worker_batch_drain", nil, telemetry.Fields{"records_drained": 2, "records_total": 10, "safety_margin_ms": int64(5000)}},
+	{"workflow_execution", telemetry.Tags{"status": "started"}, telemetry.Fields{"work_id": 1, "execution_name": "work-1"}},
+	{"workflow_execution", telemetry.Tags{"status": "succeeded"}, telemetry.Fields{"work_id": 1, "execution_duration_ms": int64(60000), "status_checks": 2}},
+}
+
+func TestMetricsSchema(t *testing.T) {
+	if err := metricsSchema.Validate(); err != nil {
+		t.Fatalf("metrics schema is invalid: %v", err)
+	}
+
+	emitted := map[string]bool{}
+	for _, point := range emittedPoints {
+		emitted[point.name] = true
+		if err := metricsSchema.Check(point.name, point.tags, point.fields); err != nil {
+			t.Errorf("%s point breaks the metrics schema: %v", point.name, err)
+		}
+	}
+
+	for name := range metricsSchema {
+		if !emitted[name] {
+			t.Errorf("measurement %s is in the metrics schema but has no emitted point", name)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+-- Columns of the users table the update_profile data action writes. Safe to
+-- run against an existing table: it only adds what is missing.
+CREATE TABLE IF NOT EXISTS users (
+    id BIGINT PRIMARY KEY
+);
+
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS display_name TEXT,
+    ADD COLUMN IF NOT EXISTS email TEXT,
+    ADD COLUMN IF NOT EXISTS phone TEXT,
+    ADD COLUMN IF NOT EXISTS locale TEXT,
+    ADD COLUMN IF NOT EXISTS timezone TEXT,
+    ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1,
+    ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
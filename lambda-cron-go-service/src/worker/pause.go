@@ -0,0 +1,27 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"lambda-cron-go-service/internal/env"
+	"lambda-cron-go-service/internal/pause"
+	"lambda-cron-go-service/internal/telemetry"
+)
+
+const defaultPauseHold = 15 * time.Minute
+
+// isPaused reports whether items of workType should be held back, for
+// either pause mode or the kill switch.
+func isPaused(ctx context.Context, workType string, metrics telemetry.MetricsSink) bool {
+	current := pause.Current(ctx, "worker", metrics)
+	return current.KillSwitch || current.Mode(workType) != ""
+}
+
+// pauseHoldDuration is how long a paused message is hidden before the
+// worker checks the pause list again, from PAUSE_HOLD_SECONDS. Each hold
+// counts as a receive towards the queue's redrive policy, so it should be
+// long enough to outlast a typical pause.
+func pauseHoldDuration() time.Duration {
+	return time.Duration(env.Int("PAUSE_HOLD_SECONDS", int(defaultPauseHold.Seconds()))) * time.Second
+}
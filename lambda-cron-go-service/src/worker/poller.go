@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+
+	"lambda-cron-go-service/internal/env"
+	"lambda-cron-go-service/internal/telemetry"
+)
+
+// pollerConfig controls the standalone poller. Every setting comes from an
+// environment variable so the worker image runs unchanged on Lambda, ECS or
+// a laptop.
+type pollerConfig struct {
+	QueueURL        string
+	Concurrency     int
+	BatchSize       int
+	WaitTime        time.Duration
+	BatchTimeout    time.Duration
+	ShutdownTimeout time.Duration
+}
+
+func loadPollerConfig() (pollerConfig, error) {
+	cfg := pollerConfig{
+		QueueURL:        os.Getenv("SQS_QUEUE_URL"),
+		Concurrency:     env.Int("POLLER_CONCURRENCY", 4),
+		BatchSize:       env.Int("POLLER_BATCH_SIZE", 10),
+		WaitTime:        time.Duration(env.Int("POLLER_WAIT_SECONDS", 20)) * time.Second,
+		BatchTimeout:    time.Duration(env.Int("POLLER_BATCH_TIMEOUT_SECONDS", 240)) * time.Second,
+		ShutdownTimeout: time.Duration(env.Int("POLLER_SHUTDOWN_TIMEOUT_SECONDS", 25)) * time.Second,
+	}
+
+	if cfg.QueueURL == "" {
+		return cfg, fmt.Errorf("SQS_QUEUE_URL environment variable is not set")
+	}
+	if cfg.BatchSize > maxBatchEntries {
+		cfg.BatchSize = maxBatchEntries
+	}
+	if cfg.WaitTime > 20*time.Second {
+		cfg.WaitTime = 20 * time.Second
+	}
+
+	return cfg, nil
+}
+
+// runPoller long-polls the work queue and feeds each received batch to
+// Handler, as the Lambda event source mapping would. Only messages Handler
+// settled, by succeeding or failing permanently, are deleted; nothing is
+// deleted when Handler fails outright. Each batch gets a deadline of
+// POLLER_BATCH_TIMEOUT_SECONDS, standing in for the Lambda timeout, which
+// should stay below the queue's visibility timeout of 300 seconds so the
+// deletes land before the messages become visible again.
+//
+// On SIGTERM or SIGINT the poller stops receiving and waits up to
+// POLLER_SHUTDOWN_TIMEOUT_SECONDS for batches in flight; anything still
+// running after that is cancelled and left on the queue to reappear once
+// its visibility timeout expires.
+func runPoller() error {
+	pollerCfg, err := loadPollerConfig()
+	if err != nil {
+		return err
+	}
+
+	signalCtx, stopSignals := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stopSignals()
+
+	// Processing outlives the signal so batches in flight can finish
+	processCtx, cancelProcessing := context.WithCancel(context.Background())
+	defer cancelProcessing()
+
+	awsCfg, err := telemetry.GetAWSConfig(processCtx)
+	if err != nil {
+		return fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	client := sqs.NewFromConfig(awsCfg)
+
+	slog.Info("Polling queue", "queue_url", pollerCfg.QueueURL, "workers", pollerCfg.Concurrency)
+
+	var wg sync.WaitGroup
+	for i := 0; i < pollerCfg.Concurrency; i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			pollQueue(signalCtx, processCtx, client, pollerCfg, worker)
+		}(i)
+	}
+
+	<-signalCtx.Done()
+	slog.Info("Shutdown requested, waiting for batches in flight", "timeout", pollerCfg.ShutdownTimeout.String())
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		slog.Info("Poller stopped")
+	case <-time.After(pollerCfg.ShutdownTimeout):
+		slog.Warn("Shutdown timeout reached, cancelling batches in flight")
+		cancelProcessing()
+		<-done
+	}
+
+	return nil
+}
+
+func pollQueue(signalCtx context.Context, processCtx context.Context, client *sqs.Client, cfg pollerConfig, worker int) {
+	for signalCtx.Err() == nil {
+		result, err := client.ReceiveMessage(signalCtx, &sqs.ReceiveMessageInput{
+			QueueUrl:              aws.String(cfg.QueueURL),
+			MaxNumberOfMessages:   int32(cfg.BatchSize),
+			WaitTimeSeconds:       int32(cfg.WaitTime.Seconds()),
+			AttributeNames:        []types.QueueAttributeName{types.QueueAttributeNameAll},
+			MessageAttributeNames: []string{"All"},
+		})
+		if err != nil {
+			if signalCtx.Err() != nil {
+				return
+			}
+			slog.Warn("Failed to receive messages", "poller", worker, "error", err)
+			sleepContext(signalCtx, time.Second)
+			continue
+		}
+		if len(result.Messages) == 0 {
+			continue
+		}
+
+		processReceivedBatch(processCtx, client, cfg, result.Messages)
+	}
+}
+
+func processReceivedBatch(ctx context.Context, client *sqs.Client, cfg pollerConfig, messages []types.Message) {
+	batchCtx, cancel := context.WithTimeout(ctx, cfg.BatchTimeout)
+	defer cancel()
+
+	sqsEvent := events.SQSEvent{Records: make([]events.SQSMessage, 0, len(messages))}
+	for _, message := range messages {
+		sqsEvent.Records = append(sqsEvent.Records, toSQSEventMessage(message))
+	}
+
+	response, err := Handler(batchCtx, sqsEvent)
+	if err != nil {
+		slog.Error("Batch failed, leaving its messages on the queue", "messages", len(messages), "error", err)
+		return
+	}
+
+	settled := settledMessages(response)
+
+	var entries []types.DeleteMessageBatchRequestEntry
+	for i, message := range messages {
+		if !settled[aws.ToString(message.MessageId)] {
+			continue
+		}
+		entries = append(entries, types.DeleteMessageBatchRequestEntry{
+			Id:            aws.String(strconv.Itoa(i)),
+			ReceiptHandle: message.ReceiptHandle,
+		})
+	}
+	if len(entries) == 0 {
+		return
+	}
+
+	// Deleting is not tied to the batch deadline; a finished batch should
+	// not be redelivered just because it ran long
+	result, err := client.DeleteMessageBatch(context.WithoutCancel(ctx), &sqs.DeleteMessageBatchInput{
+		QueueUrl: aws.String(cfg.QueueURL),
+		Entries:  entries,
+	})
+	if err == nil && len(result.Failed) > 0 {
+		err = errors.New(aws.ToString(result.Failed[0].Message))
+	}
+	if err != nil {
+		slog.Warn("Failed to delete processed messages, they will be redelivered", "error", err)
+	}
+}
+
+// settledMessages returns the IDs of the messages Handler is done with: those
+// that succeeded or failed permanently and are not batch item failures.
+// Retries, deferrals and records a cancelled batch never reached stay on
+// the queue.
+func settledMessages(response WorkerResponse) map[string]bool {
+	settled := map[string]bool{}
+	for _, item := range response.Processing.ProcessedItems {
+		settled[item.MessageId] = true
+	}
+	for _, item := range response.Processing.FailedItems {
+		if item.Status != "retry" {
+			settled[item.MessageId] = true
+		}
+	}
+	for _, failure := range response.BatchItemFailures {
+		delete(settled, failure.ItemIdentifier)
+	}
+	return settled
+}
+
+// toSQSEventMessage converts a received message into the shape the Lambda
+// event source mapping delivers.
+func toSQSEventMessage(message types.Message) events.SQSMessage {
+	record := events.SQSMessage{
+		MessageId:         aws.ToString(message.MessageId),
+		ReceiptHandle:     aws.ToString(message.ReceiptHandle),
+		Body:              aws.ToString(message.Body),
+		Md5OfBody:         aws.ToString(message.MD5OfBody),
+		Attributes:        message.Attributes,
+		MessageAttributes: make(map[string]events.SQSMessageAttribute, len(message.MessageAttributes)),
+		EventSource:       "aws:sqs",
+	}
+
+	for name, value := range message.MessageAttributes {
+		record.MessageAttributes[name] = events.SQSMessageAttribute{
+			DataType:         aws.ToString(value.DataType),
+			StringValue:      value.StringValue,
+			BinaryValue:      value.BinaryValue,
+			StringListValues: value.StringListValues,
+		}
+	}
+
+	return record
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+
+	"lambda-cron-go-service/internal/telemetry"
+)
+
+const (
+	// maxMessageDelay is the longest delivery delay SQS supports.
+	maxMessageDelay = 15 * time.Minute
+
+	// maxBatchEntries is the most messages a single SendMessageBatch call
+	// accepts.
+	maxBatchEntries = 10
+
+	// maxVisibilityTimeout is the longest visibility timeout SQS supports.
+	maxVisibilityTimeout = 12 * time.Hour
+)
+
+// queuedWorkItem is a work item to send together with its delivery delay.
+type queuedWorkItem struct {
+	Item  WorkItem
+	Delay time.Duration
+}
+
+// enqueueWorkItem sends a follow-up work item to the work queue, delivered
+// after delay.
+func enqueueWorkItem(ctx context.Context, item WorkItem, delay time.Duration) (string, error) {
+	queueURL := os.Getenv("SQS_QUEUE_URL")
+	if queueURL == "" {
+		return "", fmt.Errorf("SQS_QUEUE_URL environment variable is not set")
+	}
+
+	cfg, err := telemetry.GetAWSConfig(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	messageBody, err := json.Marshal(item)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal work item %d: %w", item.ID, err)
+	}
+
+	result, err := sqs.NewFromConfig(cfg).SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:          aws.String(queueURL),
+		MessageBody:       aws.String(string(messageBody)),
+		DelaySeconds:      delaySeconds(delay),
+		MessageAttributes: workItemAttributes(ctx, item),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to send work item %d to SQS: %w", item.ID, err)
+	}
+
+	return *result.MessageId, nil
+}
+
+// enqueueWorkItems sends work items to the work queue with SendMessageBatch,
+// up to ten per call, and returns the message IDs of the items sent, keyed
+// by work ID. It returns an error naming every item SQS did not accept;
+// the items it returns were sent all the same.
+func enqueueWorkItems(ctx context.Context, items []queuedWorkItem) (map[int]string, error) {
+	queueURL := os.Getenv("SQS_QUEUE_URL")
+	if queueURL == "" {
+		return nil, fmt.Errorf("SQS_QUEUE_URL environment variable is not set")
+	}
+
+	cfg, err := telemetry.GetAWSConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	client := sqs.NewFromConfig(cfg)
+
+	sent := make(map[int]string, len(items))
+	var failed []string
+	for start := 0; start < len(items); start += maxBatchEntries {
+		end := start + maxBatchEntries
+		if end > len(items) {
+			end = len(items)
+		}
+
+		entries := make([]types.SendMessageBatchRequestEntry, 0, end-start)
+		workIds := make(map[string]int, end-start)
+		for i, queued := range items[start:end] {
+			messageBody, err := json.Marshal(queued.Item)
+			if err != nil {
+				return sent, fmt.Errorf("failed to marshal work item %d: %w", queued.Item.ID, err)
+			}
+
+			entryId := strconv.Itoa(start + i)
+			workIds[entryId] = queued.Item.ID
+			entries = append(entries, types.SendMessageBatchRequestEntry{
+				Id:                aws.String(entryId),
+				MessageBody:       aws.String(string(messageBody)),
+				DelaySeconds:      delaySeconds(queued.Delay),
+				MessageAttributes: workItemAttributes(ctx, queued.Item),
+			})
+		}
+
+		result, err := client.SendMessageBatch(ctx, &sqs.SendMessageBatchInput{
+			QueueUrl: aws.String(queueURL),
+			Entries:  entries,
+		})
+		if err != nil {
+			return sent, fmt.Errorf("failed to send work item batch to SQS: %w", err)
+		}
+
+		for _, entry := range result.Successful {
+			sent[workIds[aws.ToString(entry.Id)]] = aws.ToString(entry.MessageId)
+		}
+		for _, entry := range result.Failed {
+			failed = append(failed, fmt.Sprintf("%d (%s)", workIds[aws.ToString(entry.Id)], aws.ToString(entry.Message)))
+		}
+	}
+
+	if len(failed) > 0 {
+		return sent, fmt.Errorf("SQS rejected work items %s", strings.Join(failed, ", "))
+	}
+
+	return sent, nil
+}
+
+// changeMessageVisibility keeps a received message hidden from other
+// consumers for timeout from now.
+func changeMessageVisibility(ctx context.Context, record events.SQSMessage, timeout time.Duration) error {
+	queueURL := os.Getenv("SQS_QUEUE_URL")
+	if queueURL == "" {
+		return fmt.Errorf("SQS_QUEUE_URL environment variable is not set")
+	}
+
+	cfg, err := telemetry.GetAWSConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	if timeout > maxVisibilityTimeout {
+		timeout = maxVisibilityTimeout
+	}
+
+	_, err = sqs.NewFromConfig(cfg).ChangeMessageVisibility(ctx, &sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          aws.String(queueURL),
+		ReceiptHandle:     aws.String(record.ReceiptHandle),
+		VisibilityTimeout: int32(math.Ceil(timeout.Seconds())),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to change visibility of message %s: %w", record.MessageId, err)
+	}
+
+	return nil
+}
+
+func delaySeconds(delay time.Duration) int32 {
+	if delay > maxMessageDelay {
+		delay = maxMessageDelay
+	}
+	return int32(delay.Seconds())
+}
+
+// workItemAttributes describes item for queue consumers, stamps the time
+// it was enqueued and carries the current trace so the item's processing
+// joins it.
+func workItemAttributes(ctx context.Context, item WorkItem) map[string]types.MessageAttributeValue {
+	return telemetry.InjectTraceAttributes(ctx, map[string]types.MessageAttributeValue{
+		"workType": {
+			DataType:    aws.String("String"),
+			StringValue: aws.String(item.Type),
+		},
+		"workId": {
+			DataType:    aws.String("Number"),
+			StringValue: aws.String(strconv.Itoa(item.ID)),
+		},
+		enqueuedAtAttribute: {
+			DataType:    aws.String("Number"),
+			StringValue: aws.String(strconv.FormatInt(time.Now().UnixMilli(), 10)),
+		},
+	})
+}
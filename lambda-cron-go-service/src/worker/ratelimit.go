@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"math/rand"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"lambda-cron-go-service/internal/telemetry"
+)
+
+// sharedRateLimitAttempts bounds optimistic retries when concurrent workers
+// race for the same shared bucket.
+const sharedRateLimitAttempts = 3
+
+// rateLimit caps the throughput of one work type. Burst is the bucket size
+// and defaults to one second's worth of tokens.
+type rateLimit struct {
+	RatePerSecond float64 `json:"ratePerSecond"`
+	Burst         float64 `json:"burst"`
+}
+
+func (l rateLimit) capacity() float64 {
+	if l.Burst >= 1 {
+		return l.Burst
+	}
+	return math.Max(1, l.RatePerSecond)
+}
+
+// waitFor returns how long until the bucket holds a whole token again.
+func (l rateLimit) waitFor(tokens float64) time.Duration {
+	return time.Duration((1 - tokens) / l.RatePerSecond * float64(time.Second))
+}
+
+// rateLimiter takes a token for a work type. It returns zero when the item
+// may run now, or how long it should wait otherwise.
+type rateLimiter interface {
+	Take(ctx context.Context, workType string, limit rateLimit) (time.Duration, error)
+}
+
+var (
+	rateLimiterOnce sync.Once
+	rateLimits      map[string]rateLimit
+	activeLimiter   rateLimiter
+)
+
+// getRateLimiter loads the per-type limits from RATE_LIMITS, a JSON object
+// keyed by work type, and builds the limiter selected by RATE_LIMIT_MODE:
+// "local" buckets per execution environment, or "shared" buckets in the
+// DynamoDB table named by RATE_LIMIT_TABLE_NAME that cap all concurrent
+// workers together. Both live for the execution environment.
+func getRateLimiter(ctx context.Context) (rateLimiter, map[string]rateLimit) {
+	rateLimiterOnce.Do(func() {
+		raw := os.Getenv("RATE_LIMITS")
+		if raw == "" {
+			return
+		}
+
+		if err := json.Unmarshal([]byte(raw), &rateLimits); err != nil {
+			slog.WarnContext(ctx, "Ignoring invalid RATE_LIMITS", "error", err)
+			rateLimits = nil
+			return
+		}
+
+		switch mode := os.Getenv("RATE_LIMIT_MODE"); mode {
+		case "", "local":
+			activeLimiter = &localRateLimiter{buckets: map[string]*tokenBucket{}}
+		case "shared":
+			tableName := os.Getenv("RATE_LIMIT_TABLE_NAME")
+			cfg, err := telemetry.GetAWSConfig(ctx)
+			if tableName == "" || err != nil {
+				slog.WarnContext(ctx, "Shared rate limiting needs RATE_LIMIT_TABLE_NAME and AWS config, falling back to local limits", "error", err)
+				activeLimiter = &localRateLimiter{buckets: map[string]*tokenBucket{}}
+				return
+			}
+			activeLimiter = &dynamoRateLimiter{client: dynamodb.NewFromConfig(cfg), tableName: tableName}
+		default:
+			slog.WarnContext(ctx, "Unknown RATE_LIMIT_MODE, falling back to local limits", "mode", mode)
+			activeLimiter = &localRateLimiter{buckets: map[string]*tokenBucket{}}
+		}
+	})
+
+	return activeLimiter, rateLimits
+}
+
+// throttleWorkItem takes a token for the item's work type and returns how
+// long the item should be deferred, or zero if it may run now. A limiter
+// that cannot be reached lets the item through rather than stalling the
+// queue.
+func throttleWorkItem(ctx context.Context, workItem WorkItem, metrics telemetry.MetricsSink) time.Duration {
+	limiter, limits := getRateLimiter(ctx)
+	limit, ok := limits[workItem.Type]
+	if limiter == nil || !ok || limit.RatePerSecond <= 0 {
+		return 0
+	}
+
+	wait, err := limiter.Take(ctx, workItem.Type, limit)
+	if err != nil {
+		slog.WarnContext(ctx, "Rate limiter unavailable, allowing work item", "error", err)
+		return 0
+	}
+	if wait <= 0 {
+		return 0
+	}
+
+	// Spread deferred items out so they do not all return at once
+	delay := wait + time.Duration(rand.Int63n(int64(time.Second)))
+	if delay < time.Second {
+		delay = time.Second
+	}
+
+	// Record the deferral
+	metrics.Event("rate_limit", telemetry.Tags{
+		"work_type": workItem.Type,
+		"decision":  "deferred",
+	}, telemetry.Fields{
+		"work_id":         workItem.ID,
+		"delay_ms":        delay.Milliseconds(),
+		"rate_per_second": limit.RatePerSecond,
+	})
+
+	return delay
+}
+
+// deferMessage hides a message from the queue for delay. The caller reports
+// it as a batch item failure so SQS keeps it; every deferral still counts
+// as a receive towards the queue's redrive policy.
+func deferMessage(ctx context.Context, record events.SQSMessage, delay time.Duration) error {
+	return changeMessageVisibility(ctx, record, delay)
+}
+
+type tokenBucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+// localRateLimiter keeps one token bucket per work type in memory.
+type localRateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+func (l *localRateLimiter) Take(ctx context.Context, workType string, limit rateLimit) (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	bucket, ok := l.buckets[workType]
+	if !ok {
+		bucket = &tokenBucket{tokens: limit.capacity(), updatedAt: now}
+		l.buckets[workType] = bucket
+	}
+
+	bucket.tokens = math.Min(limit.capacity(), bucket.tokens+now.Sub(bucket.updatedAt).Seconds()*limit.RatePerSecond)
+	bucket.updatedAt = now
+
+	if bucket.tokens < 1 {
+		return limit.waitFor(bucket.tokens), nil
+	}
+
+	bucket.tokens--
+	return 0, nil
+}
+
+// dynamoRateLimiter keeps token buckets in a DynamoDB table keyed by work
+// type. Buckets are refilled on read and updated with a version check, so
+// concurrent workers never spend the same token twice.
+type dynamoRateLimiter struct {
+	client    *dynamodb.Client
+	tableName string
+}
+
+func (l *dynamoRateLimiter) Take(ctx context.Context, workType string, limit rateLimit) (time.Duration, error) {
+	key := map[string]ddbtypes.AttributeValue{
+		"workType": &ddbtypes.AttributeValueMemberS{Value: workType},
+	}
+
+	for attempt := 0; attempt < sharedRateLimitAttempts; attempt++ {
+		result, err := l.client.GetItem(ctx, &dynamodb.GetItemInput{
+			TableName:      aws.String(l.tableName),
+			Key:            key,
+			ConsistentRead: aws.Bool(true),
+		})
+		if err != nil {
+			return 0, fmt.Errorf("failed to read rate limit bucket for %s: %w", workType, err)
+		}
+
+		now := time.Now()
+		tokens := limit.capacity()
+		version := int64(0)
+
+		if result.Item != nil {
+			storedTokens, err := numberAttribute(result.Item, "tokens")
+			if err != nil {
+				return 0, err
+			}
+			updatedAt, err := numberAttribute(result.Item, "updatedAt")
+			if err != nil {
+				return 0, err
+			}
+			storedVersion, err := numberAttribute(result.Item, "version")
+			if err != nil {
+				return 0, err
+			}
+
+			elapsed := now.Sub(time.UnixMilli(int64(updatedAt))).Seconds()
+			tokens = math.Min(limit.capacity(), storedTokens+math.Max(0, elapsed)*limit.RatePerSecond)
+			version = int64(storedVersion)
+		}
+
+		if tokens < 1 {
+			return limit.waitFor(tokens), nil
+		}
+
+		condition := "attribute_not_exists(workType)"
+		values := map[string]ddbtypes.AttributeValue{
+			":tokens":    &ddbtypes.AttributeValueMemberN{Value: strconv.FormatFloat(tokens-1, 'f', -1, 64)},
+			":updatedAt": &ddbtypes.AttributeValueMemberN{Value: strconv.FormatInt(now.UnixMilli(), 10)},
+			":version":   &ddbtypes.AttributeValueMemberN{Value: strconv.FormatInt(version+1, 10)},
+		}
+		if result.Item != nil {
+			condition = "version = :expected"
+			values[":expected"] = &ddbtypes.AttributeValueMemberN{Value: strconv.FormatInt(version, 10)}
+		}
+
+		_, err = l.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName:                 aws.String(l.tableName),
+			Key:                       key,
+			UpdateExpression:          aws.String("SET tokens = :tokens, updatedAt = :updatedAt, version = :version"),
+			ConditionExpression:       aws.String(condition),
+			ExpressionAttributeValues: values,
+		})
+		if err == nil {
+			return 0, nil
+		}
+
+		var conditionFailed *ddbtypes.ConditionalCheckFailedException
+		if !errors.As(err, &conditionFailed) {
+			return 0, fmt.Errorf("failed to update rate limit bucket for %s: %w", workType, err)
+		}
+	}
+
+	// Heavy contention for the bucket means it is close to empty anyway
+	return limit.waitFor(0), nil
+}
+
+func numberAttribute(item map[string]ddbtypes.AttributeValue, name string) (float64, error) {
+	value, ok := item[name].(*ddbtypes.AttributeValueMemberN)
+	if !ok {
+		return 0, fmt.Errorf("rate limit bucket is missing %s", name)
+	}
+	return strconv.ParseFloat(value.Value, 64)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"lambda-cron-go-service/internal/telemetry"
+)
+
+// storeReport writes a generated report to S3 and returns its key.
+func storeReport(ctx context.Context, bucket string, workItem WorkItem, reportType string, userId int, reportSize int) (string, error) {
+	cfg, err := telemetry.GetAWSConfig(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	generatedAt := time.Now().UTC()
+	key := fmt.Sprintf("reports/%s/%d/%s-%d.json", reportType, userId, generatedAt.Format("20060102T150405Z"), workItem.ID)
+
+	body, err := json.Marshal(map[string]interface{}{
+		"workId":       workItem.ID,
+		"reportType":   reportType,
+		"userId":       userId,
+		"reportSizeKb": reportSize,
+		"generatedAt":  generatedAt.Format(time.RFC3339),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal report: %w", err)
+	}
+
+	_, err = s3.NewFromConfig(cfg).PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String("application/json"),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to store report in s3://%s/%s: %w", bucket, key, err)
+	}
+
+	return key, nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strconv"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"lambda-cron-go-service/internal/workstatus"
+)
+
+// recordStatus writes a transition for a work item received from SQS.
+// Status tracking is best effort: failures are logged and never fail the
+// work item. Items without a run ID are not tracked.
+func recordStatus(ctx context.Context, store *workstatus.Store, workItem WorkItem, record events.SQSMessage,
+	status string, attempt int, errorMessage *string) {
+	if store == nil || workItem.RunId == "" {
+		return
+	}
+
+	err := store.Record(ctx, workstatus.Transition{
+		RunId:         workItem.RunId,
+		WorkId:        workItem.ID,
+		WorkType:      statusWorkType(workItem),
+		Status:        status,
+		MessageId:     record.MessageId,
+		CorrelationId: workItem.CorrelationId,
+		Attempt:       attempt,
+		Error:         errorMessage,
+	})
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to record work item status", "error", err)
+	}
+}
+
+// maxReceiveCount mirrors the queue's redrive policy so the worker can tell
+// when a failed attempt was the last one before the DLQ.
+func maxReceiveCount() int {
+	if count, err := strconv.Atoi(os.Getenv("MAX_RECEIVE_COUNT")); err == nil && count > 0 {
+		return count
+	}
+	return 3
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"lambda-cron-go-service/internal/telemetry"
+)
+
+// sqsTraceCarrier reads W3C trace context from a record's message
+// attributes, where the producer and workItemAttributes put it.
+type sqsTraceCarrier map[string]events.SQSMessageAttribute
+
+func (c sqsTraceCarrier) Get(key string) string {
+	if attr, ok := c[key]; ok && attr.StringValue != nil {
+		return *attr.StringValue
+	}
+	return ""
+}
+
+func (c sqsTraceCarrier) Set(key, value string) {}
+
+func (c sqsTraceCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// queryTracer gives every database query a client span. Statements are
+// parameterised, so the SQL recorded carries no values.
+type queryTracer struct{}
+
+func (queryTracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	operation, _, _ := strings.Cut(strings.TrimSpace(data.SQL), " ")
+	ctx, _ = telemetry.Tracer().Start(ctx, "postgres "+strings.ToUpper(operation),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.statement", data.SQL),
+		))
+	return ctx
+}
+
+func (queryTracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	telemetry.EndSpan(trace.SpanFromContext(ctx), data.Err)
+}
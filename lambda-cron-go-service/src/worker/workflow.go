@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sfn"
+	sfntypes "github.com/aws/aws-sdk-go-v2/service/sfn/types"
+
+	"lambda-cron-go-service/internal/telemetry"
+)
+
+const (
+	defaultWorkflowPollInterval = 30 * time.Second
+	defaultWorkflowMaxPolls     = 40
+)
+
+// Payload keys that control the workflow work type itself and are not
+// passed to the state machine.
+var workflowControlKeys = []string{"waitForCompletion", "pollIntervalSeconds", "maxPolls"}
+
+var invalidExecutionNameChars = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+var (
+	sfnClientMu sync.Mutex
+	sfnClient   *sfn.Client
+)
+
+// getSFNClient returns the Step Functions client, built on first use and
+// kept for the execution environment.
+func getSFNClient(ctx context.Context) (*sfn.Client, error) {
+	sfnClientMu.Lock()
+	defer sfnClientMu.Unlock()
+
+	if sfnClient == nil {
+		cfg, err := telemetry.GetAWSConfig(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load AWS config: %w", err)
+		}
+		sfnClient = sfn.NewFromConfig(cfg)
+	}
+
+	return sfnClient, nil
+}
+
+// processWorkflow starts the Step Functions state machine named by
+// WORKFLOW_STATE_MACHINE_ARN with the payload as input and returns without
+// waiting for it. The execution name is derived from the work item, so a
+// redelivered message finds the existing execution instead of starting a
+// second one. With waitForCompletion set, a workflow_status item is queued
+// to follow the execution until it ends, and the work item stays running,
+// holding back its dependents, until then. Handler skips redeliveries of an
+// item already running, so an existing execution here means the attempt
+// that started it failed before its status checks were queued.
+func processWorkflow(ctx context.Context, workItem WorkItem, metrics telemetry.MetricsSink) (WorkResult, error) {
+	slog.DebugContext(ctx, "Processing workflow", "payload", workItem.Payload)
+
+	stateMachineArn := os.Getenv("WORKFLOW_STATE_MACHINE_ARN")
+	if stateMachineArn == "" {
+		return nil, fmt.Errorf("WORKFLOW_STATE_MACHINE_ARN environment variable is not set")
+	}
+
+	input := make(map[string]interface{}, len(workItem.Payload))
+	for key, value := range workItem.Payload {
+		input[key] = value
+	}
+	for _, key := range workflowControlKeys {
+		delete(input, key)
+	}
+
+	inputJSON, err := json.Marshal(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal workflow input: %w", err)
+	}
+
+	client, err := getSFNClient(ctx)
+	if err != nil {
+		return nil, retryable(err)
+	}
+
+	name := workflowExecutionName(workItem)
+	executionArn := strings.Replace(stateMachineArn, ":stateMachine:", ":execution:", 1) + ":" + name
+	status := "started"
+
+	var result *sfn.StartExecutionOutput
+	err = withCircuitBreaker(ctx, "stepfunctions", metrics, func() error {
+		var err error
+		result, err = client.StartExecution(ctx, &sfn.StartExecutionInput{
+			StateMachineArn: aws.String(stateMachineArn),
+			Name:            aws.String(name),
+			Input:           aws.String(string(inputJSON)),
+		})
+
+		var exists *sfntypes.ExecutionAlreadyExists
+		if err != nil && !errors.As(err, &exists) {
+			return retryable(fmt.Errorf("failed to start workflow execution %s: %w", name, err))
+		}
+		return err
+	})
+	if err != nil {
+		var exists *sfntypes.ExecutionAlreadyExists
+		if !errors.As(err, &exists) {
+			return nil, err
+		}
+		slog.InfoContext(ctx, "Workflow execution already exists", "execution_name", name)
+		status = "already_started"
+	} else {
+		executionArn = *result.ExecutionArn
+		slog.InfoContext(ctx, "Started workflow execution", "execution_arn", executionArn)
+	}
+
+	// Record workflow start
+	metrics.Event("workflow_execution", telemetry.Tags{
+		"status": status,
+	}, telemetry.Fields{
+		"work_id":        workItem.ID,
+		"execution_name": name,
+	})
+
+	results := WorkResult{"executionArn": executionArn, "executionName": name}
+
+	if wait, _ := workItem.Payload["waitForCompletion"].(bool); wait {
+		pollInterval := defaultWorkflowPollInterval
+		if seconds, ok := workItem.Payload["pollIntervalSeconds"].(float64); ok && seconds >= 1 {
+			pollInterval = time.Duration(seconds) * time.Second
+		}
+
+		maxPolls := defaultWorkflowMaxPolls
+		if polls, ok := workItem.Payload["maxPolls"].(float64); ok && polls >= 1 {
+			maxPolls = int(polls)
+		}
+
+		// Status checks carry the run and work IDs, so the outcome of the
+		// execution is recorded on the work item's own status record
+		followUp := WorkItem{
+			ID:   workItem.ID,
+			Type: "workflow_status",
+			Payload: map[string]interface{}{
+				"executionArn":        executionArn,
+				"pollIntervalSeconds": pollInterval.Seconds(),
+				"maxPolls":            maxPolls,
+				"polls":               0,
+			},
+			CorrelationId: workItem.CorrelationId,
+			RunId:         workItem.RunId,
+		}
+
+		if _, err := enqueueWorkItem(ctx, followUp, pollInterval); err != nil {
+			return nil, retryable(fmt.Errorf("failed to schedule workflow status check: %w", err))
+		}
+		results["statusCheckScheduled"] = true
+	}
+
+	return results, nil
+}
+
+// processWorkflowStatus checks on a workflow execution started by
+// processWorkflow. While the execution is running it queues itself again
+// after the poll interval; once it ends the outcome is recorded and a
+// failed, timed out or aborted execution fails the item.
+func processWorkflowStatus(ctx context.Context, workItem WorkItem, metrics telemetry.MetricsSink) (WorkResult, error) {
+	payload := workItem.Payload
+
+	executionArn, ok := payload["executionArn"].(string)
+	if !ok || executionArn == "" {
+		return nil, fmt.Errorf("missing or invalid executionArn in payload")
+	}
+
+	pollSeconds, _ := payload["pollIntervalSeconds"].(float64)
+	pollInterval := time.Duration(pollSeconds) * time.Second
+	if pollInterval < time.Second {
+		pollInterval = defaultWorkflowPollInterval
+	}
+
+	maxPollsFloat, _ := payload["maxPolls"].(float64)
+	maxPolls := int(maxPollsFloat)
+	if maxPolls < 1 {
+		maxPolls = defaultWorkflowMaxPolls
+	}
+
+	pollsFloat, _ := payload["polls"].(float64)
+	polls := int(pollsFloat) + 1
+
+	client, err := getSFNClient(ctx)
+	if err != nil {
+		return nil, retryable(err)
+	}
+
+	var execution *sfn.DescribeExecutionOutput
+	err = withCircuitBreaker(ctx, "stepfunctions", metrics, func() error {
+		var err error
+		execution, err = client.DescribeExecution(ctx, &sfn.DescribeExecutionInput{
+			ExecutionArn: aws.String(executionArn),
+		})
+		if err != nil {
+			var missing *sfntypes.ExecutionDoesNotExist
+			if errors.As(err, &missing) {
+				return fmt.Errorf("workflow execution %s does not exist", executionArn)
+			}
+			return retryable(fmt.Errorf("failed to describe workflow execution %s: %w", executionArn, err))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	status := string(execution.Status)
+	results := WorkResult{"executionArn": executionArn, "status": status, "polls": polls}
+
+	if execution.Status == sfntypes.ExecutionStatusRunning {
+		if polls >= maxPolls {
+			return nil, fmt.Errorf("workflow execution %s still running after %d status checks", executionArn, polls)
+		}
+
+		next := workItem
+		next.Payload = make(map[string]interface{}, len(payload))
+		for key, value := range payload {
+			next.Payload[key] = value
+		}
+		next.Payload["polls"] = polls
+
+		if _, err := enqueueWorkItem(ctx, next, pollInterval); err != nil {
+			return nil, retryable(fmt.Errorf("failed to schedule workflow status check: %w", err))
+		}
+
+		slog.InfoContext(ctx, "Workflow execution still running", "execution_arn", executionArn, "check_again_in", pollInterval.String())
+		results["statusCheckScheduled"] = true
+		return results, nil
+	}
+
+	var durationMs int64
+	if execution.StartDate != nil && execution.StopDate != nil {
+		durationMs = execution.StopDate.Sub(*execution.StartDate).Milliseconds()
+	}
+	slog.InfoContext(ctx, "Workflow execution ended", "execution_arn", executionArn, "status", status, "duration_ms", durationMs)
+
+	// Record workflow outcome
+	metrics.Event("workflow_execution", telemetry.Tags{
+		"status": strings.ToLower(status),
+	}, telemetry.Fields{
+		"work_id":               workItem.ID,
+		"execution_duration_ms": durationMs,
+		"status_checks":         polls,
+	})
+
+	if execution.Status != sfntypes.ExecutionStatusSucceeded {
+		return nil, fmt.Errorf("workflow execution %s ended with status %s: %s",
+			executionArn, status, aws.ToString(execution.Error))
+	}
+
+	if execution.Output != nil {
+		var output interface{}
+		if err := json.Unmarshal([]byte(*execution.Output), &output); err == nil {
+			results["output"] = output
+		}
+	}
+	results["durationMs"] = durationMs
+
+	return results, nil
+}
+
+// awaitingWorkflow reports whether a workflow or workflow_status item left
+// a status check queued, so its execution has not ended yet.
+func awaitingWorkflow(results WorkResult) bool {
+	scheduled, _ := results["statusCheckScheduled"].(bool)
+	return scheduled
+}
+
+// statusWorkType is the work type a work item's status is recorded under.
+// Status checks record the outcome of the workflow item they follow.
+func statusWorkType(workItem WorkItem) string {
+	if workItem.Type == "workflow_status" {
+		return "workflow"
+	}
+	return workItem.Type
+}
+
+// workflowExecutionName derives a Step Functions execution name (at most 80
+// characters of letters, digits, hyphens and underscores) from the work
+// item.
+func workflowExecutionName(workItem WorkItem) string {
+	base := workItem.CorrelationId
+	if base == "" {
+		base = fmt.Sprintf("work-%d", workItem.ID)
+	}
+
+	name := invalidExecutionNameChars.ReplaceAllString(base, "-")
+	if len(name) > 80 {
+		name = name[len(name)-80:]
+	}
+
+	return name
+}
@@ -22,14 +22,18 @@ REGION=$(aws configure get region || echo "us-east-1")
 # ECR repository names
 MAIN_REPO_NAME="${ENVIRONMENT}-lambda-cron-go-service"
 WORKER_REPO_NAME="${ENVIRONMENT}-lambda-cron-go-worker"
+STATUS_API_REPO_NAME="${ENVIRONMENT}-lambda-cron-go-status-api"
 
 MAIN_IMAGE_URI="${ACCOUNT_ID}.dkr.ecr.${REGION}.amazonaws.com/${MAIN_REPO_NAME}:${IMAGE_TAG}"
 WORKER_IMAGE_URI="${ACCOUNT_ID}.dkr.ecr.${REGION}.amazonaws.com/${WORKER_REPO_NAME}:${IMAGE_TAG}"
+STATUS_API_IMAGE_URI="${ACCOUNT_ID}.dkr.ecr.${REGION}.amazonaws.com/${STATUS_API_REPO_NAME}:${IMAGE_TAG}"
 
 echo "Main Repository: $MAIN_REPO_NAME"
 echo "Main Image URI: $MAIN_IMAGE_URI"
 echo "Worker Repository: $WORKER_REPO_NAME"
 echo "Worker Image URI: $WORKER_IMAGE_URI"
+echo "Status API Repository: $STATUS_API_REPO_NAME"
+echo "Status API Image URI: $STATUS_API_IMAGE_URI"
 
 # Login to ECR
 echo "Logging into ECR..."
@@ -44,10 +48,14 @@ docker build -f Dockerfile -t $MAIN_REPO_NAME:$IMAGE_TAG .
 echo "Building worker Lambda Docker image..."
 docker build -f Dockerfile.worker -t $WORKER_REPO_NAME:$IMAGE_TAG .
 
+echo "Building status API Lambda Docker image..."
+docker build -f Dockerfile.status-api -t $STATUS_API_REPO_NAME:$IMAGE_TAG .
+
 # Tag images for ECR
 echo "Tagging images for ECR..."
 docker tag $MAIN_REPO_NAME:$IMAGE_TAG $MAIN_IMAGE_URI
 docker tag $WORKER_REPO_NAME:$IMAGE_TAG $WORKER_IMAGE_URI
+docker tag $STATUS_API_REPO_NAME:$IMAGE_TAG $STATUS_API_IMAGE_URI
 
 # Push images to ECR
 echo "Pushing main image to ECR..."
@@ -56,9 +64,13 @@ docker push $MAIN_IMAGE_URI
 echo "Pushing worker image to ECR..."
 docker push $WORKER_IMAGE_URI
 
-echo "Successfully pushed both images:"
+echo "Pushing status API image to ECR..."
+docker push $STATUS_API_IMAGE_URI
+
+echo "Successfully pushed all images:"
 echo "- Main: $MAIN_IMAGE_URI"
 echo "- Worker: $WORKER_IMAGE_URI"
+echo "- Status API: $STATUS_API_IMAGE_URI"
 echo ""
 echo "Next steps:"
 echo "1. Deploy ECR repositories: cd lambda-cron-go-service/live/$ENVIRONMENT/ecr && terragrunt apply"